@@ -0,0 +1,224 @@
+// Package backoff provides the delay strategies used between retry attempts
+package backoff
+
+import (
+	"math"
+	"math/rand/v2"
+	"time"
+)
+
+// Strategy computes the delay before the next attempt
+type Strategy interface {
+	// Backoff returns the delay before retry number attempt (0 based),
+	// prev is the delay used before the previous retry or 0 for the first retry
+	Backoff(attempt int, prev time.Duration) time.Duration
+}
+
+// StrategyFunc is an adapter to allow the use of ordinary functions as a Strategy
+type StrategyFunc func(attempt int, prev time.Duration) time.Duration
+
+// Backoff calls f(attempt, prev)
+func (f StrategyFunc) Backoff(attempt int, prev time.Duration) time.Duration {
+	return f(attempt, prev)
+}
+
+// Rand is the random source used by the jitter strategies,
+// *rand.Rand from math/rand/v2 satisfies it
+type Rand interface {
+	// Int64N returns a non-negative pseudo-random number in [0,n), n > 0
+	Int64N(n int64) int64
+}
+
+// globalRand uses the concurrency safe top level functions of math/rand/v2
+type globalRand struct{}
+
+func (globalRand) Int64N(n int64) int64 {
+	return rand.Int64N(n)
+}
+
+// DefaultRand returns the random source used when none is provided
+func DefaultRand() Rand {
+	return globalRand{}
+}
+
+// Constant waits the same delay before every retry
+type Constant struct {
+	delay time.Duration
+}
+
+func NewConstant(delay time.Duration) *Constant {
+	return &Constant{delay: delay}
+}
+
+// Backoff implements the Strategy interface
+func (s *Constant) Backoff(attempt int, prev time.Duration) time.Duration {
+	return s.delay
+}
+
+// Linear waits initial + attempt*step, capped at max
+type Linear struct {
+	initial time.Duration
+	step    time.Duration
+	max     time.Duration
+}
+
+// NewLinear creates a Linear strategy, max <= 0 means no cap
+func NewLinear(initial, step, max time.Duration) *Linear {
+	return &Linear{initial: initial, step: step, max: max}
+}
+
+// Backoff implements the Strategy interface
+func (s *Linear) Backoff(attempt int, prev time.Duration) time.Duration {
+	return capped(float64(s.initial)+float64(attempt)*float64(s.step), s.max)
+}
+
+// Exponential waits base * factor^attempt, capped at max
+type Exponential struct {
+	base   time.Duration
+	factor float64
+	max    time.Duration
+}
+
+// NewExponential creates an Exponential strategy doubling the delay on every retry,
+// max <= 0 means no cap
+func NewExponential(base, max time.Duration) *Exponential {
+	return NewExponentialWithFactor(base, 2, max)
+}
+
+// NewExponentialWithFactor creates an Exponential strategy with a custom growth factor,
+// a factor < 1 is replaced by 2
+func NewExponentialWithFactor(base time.Duration, factor float64, max time.Duration) *Exponential {
+	if factor < 1 {
+		factor = 2
+	}
+
+	return &Exponential{base: base, factor: factor, max: max}
+}
+
+// Backoff implements the Strategy interface
+func (s *Exponential) Backoff(attempt int, prev time.Duration) time.Duration {
+	return capped(float64(s.base)*math.Pow(s.factor, float64(attempt)), s.max)
+}
+
+// FullJitter waits a random delay in [0, min(max, base*2^attempt)]
+// see https://aws.amazon.com/blogs/architecture/exponential-backoff-and-jitter/
+type FullJitter struct {
+	exp *Exponential
+	rnd Rand
+}
+
+// NewFullJitter creates a FullJitter strategy, a nil rnd uses DefaultRand
+func NewFullJitter(base, max time.Duration, rnd Rand) *FullJitter {
+	return &FullJitter{exp: NewExponential(base, max), rnd: orDefault(rnd)}
+}
+
+// Backoff implements the Strategy interface
+func (s *FullJitter) Backoff(attempt int, prev time.Duration) time.Duration {
+	return between(s.rnd, 0, s.exp.Backoff(attempt, prev))
+}
+
+// EqualJitter keeps half of the exponential delay and randomizes the other half,
+// it waits v/2 + random[0, v/2] where v = min(max, base*2^attempt)
+type EqualJitter struct {
+	exp *Exponential
+	rnd Rand
+}
+
+// NewEqualJitter creates an EqualJitter strategy, a nil rnd uses DefaultRand
+func NewEqualJitter(base, max time.Duration, rnd Rand) *EqualJitter {
+	return &EqualJitter{exp: NewExponential(base, max), rnd: orDefault(rnd)}
+}
+
+// Backoff implements the Strategy interface
+func (s *EqualJitter) Backoff(attempt int, prev time.Duration) time.Duration {
+	half := s.exp.Backoff(attempt, prev) / 2
+
+	return half + between(s.rnd, 0, half)
+}
+
+// DecorrelatedJitter waits min(max, random[base, prev*3]), growing from
+// the previous delay instead of the attempt number
+type DecorrelatedJitter struct {
+	base time.Duration
+	max  time.Duration
+	rnd  Rand
+}
+
+// NewDecorrelatedJitter creates a DecorrelatedJitter strategy, a nil rnd uses DefaultRand
+func NewDecorrelatedJitter(base, max time.Duration, rnd Rand) *DecorrelatedJitter {
+	return &DecorrelatedJitter{base: base, max: max, rnd: orDefault(rnd)}
+}
+
+// Backoff implements the Strategy interface
+func (s *DecorrelatedJitter) Backoff(attempt int, prev time.Duration) time.Duration {
+	if prev < s.base {
+		prev = s.base
+	}
+
+	upper := capped(float64(prev)*3, 0)
+
+	return capped(float64(between(s.rnd, s.base, upper)), s.max)
+}
+
+// jittered adds a random delay in [0, max) to the delay of a strategy
+type jittered struct {
+	strategy Strategy
+	max      time.Duration
+	rnd      Rand
+}
+
+// WithJitter adds a random delay in [0, max) to every delay computed by s,
+// a nil rnd uses DefaultRand
+func WithJitter(s Strategy, max time.Duration, rnd Rand) Strategy {
+	return &jittered{strategy: s, max: max, rnd: orDefault(rnd)}
+}
+
+// Backoff implements the Strategy interface
+func (s *jittered) Backoff(attempt int, prev time.Duration) time.Duration {
+	d := s.strategy.Backoff(attempt, prev)
+	if s.max <= 0 {
+		return d
+	}
+
+	return d + time.Duration(s.rnd.Int64N(int64(s.max)))
+}
+
+// between returns a random duration in [lo, hi]
+func between(rnd Rand, lo, hi time.Duration) time.Duration {
+	if hi <= lo {
+		return lo
+	}
+
+	n := int64(hi - lo)
+	if n < math.MaxInt64 {
+		n++
+	}
+
+	return lo + time.Duration(rnd.Int64N(n))
+}
+
+// capped converts d to a duration bounded by max, max <= 0 means no cap
+// other than the largest representable duration
+func capped(d float64, max time.Duration) time.Duration {
+	if d < 0 {
+		return 0
+	}
+
+	if max > 0 && d > float64(max) {
+		return max
+	}
+
+	if d >= math.MaxInt64 {
+		return time.Duration(math.MaxInt64)
+	}
+
+	return time.Duration(d)
+}
+
+func orDefault(rnd Rand) Rand {
+	if rnd == nil {
+		return DefaultRand()
+	}
+
+	return rnd
+}
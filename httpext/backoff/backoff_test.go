@@ -0,0 +1,59 @@
+package backoff_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/tanveerprottoy/stdlib-ext/httpext/backoff"
+)
+
+// maxRand always returns the largest value in [0,n)
+type maxRand struct{}
+
+func (maxRand) Int64N(n int64) int64 {
+	return n - 1
+}
+
+// zeroRand always returns 0
+type zeroRand struct{}
+
+func (zeroRand) Int64N(n int64) int64 {
+	return 0
+}
+
+func TestStrategies(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name     string
+		strategy backoff.Strategy
+		attempt  int
+		prev     time.Duration
+		exp      time.Duration
+	}{
+		{"constant", backoff.NewConstant(time.Second), 5, 0, time.Second},
+		{"linear", backoff.NewLinear(time.Second, 500*time.Millisecond, 0), 2, 0, 2 * time.Second},
+		{"linear capped", backoff.NewLinear(time.Second, time.Second, 3*time.Second), 10, 0, 3 * time.Second},
+		{"exponential", backoff.NewExponential(100*time.Millisecond, 0), 3, 0, 800 * time.Millisecond},
+		{"exponential capped", backoff.NewExponential(time.Second, 10*time.Second), 8, 0, 10 * time.Second},
+		{"exponential huge attempt", backoff.NewExponential(time.Second, time.Minute), 10000, 0, time.Minute},
+		{"full jitter max", backoff.NewFullJitter(time.Second, 0, maxRand{}), 2, 0, 4 * time.Second},
+		{"full jitter min", backoff.NewFullJitter(time.Second, 0, zeroRand{}), 2, 0, 0},
+		{"equal jitter min", backoff.NewEqualJitter(time.Second, 0, zeroRand{}), 2, 0, 2 * time.Second},
+		{"equal jitter max", backoff.NewEqualJitter(time.Second, 0, maxRand{}), 2, 0, 4 * time.Second},
+		{"decorrelated first", backoff.NewDecorrelatedJitter(time.Second, time.Minute, maxRand{}), 0, 0, 3 * time.Second},
+		{"decorrelated grows from prev", backoff.NewDecorrelatedJitter(time.Second, time.Minute, maxRand{}), 1, 3 * time.Second, 9 * time.Second},
+		{"decorrelated capped", backoff.NewDecorrelatedJitter(time.Second, 5*time.Second, maxRand{}), 1, 3 * time.Second, 5 * time.Second},
+		{"decorrelated min", backoff.NewDecorrelatedJitter(time.Second, time.Minute, zeroRand{}), 4, 20 * time.Second, time.Second},
+		{"with jitter", backoff.WithJitter(backoff.NewConstant(time.Second), 10*time.Millisecond, maxRand{}), 0, 0, time.Second + 10*time.Millisecond - 1},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			actual := tc.strategy.Backoff(tc.attempt, tc.prev)
+			if actual != tc.exp {
+				t.Errorf("Backoff(%d, %v) = %v; want %v", tc.attempt, tc.prev, actual, tc.exp)
+			}
+		})
+	}
+}
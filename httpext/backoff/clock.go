@@ -0,0 +1,48 @@
+package backoff
+
+import (
+	"context"
+	"time"
+)
+
+// Clock abstracts time so that retry waits can be faked in tests
+type Clock interface {
+	Now() time.Time
+
+	// After waits for the duration to elapse and then sends the current time on the returned channel
+	After(d time.Duration) <-chan time.Time
+}
+
+// systemClock is the Clock backed by the time package
+type systemClock struct{}
+
+func (systemClock) Now() time.Time {
+	return time.Now()
+}
+
+func (systemClock) After(d time.Duration) <-chan time.Time {
+	return time.After(d)
+}
+
+// SystemClock returns the Clock backed by the time package
+func SystemClock() Clock {
+	return systemClock{}
+}
+
+// Sleep waits for d on clock, it returns early with the context's error when ctx is done
+func Sleep(ctx context.Context, clock Clock, d time.Duration) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	if d <= 0 {
+		return nil
+	}
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-clock.After(d):
+		return nil
+	}
+}
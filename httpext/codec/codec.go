@@ -0,0 +1,287 @@
+// Package codec provides encoding of request and decoding of response bodies
+// selected by their media type
+package codec
+
+import (
+	"encoding"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"mime"
+	"net/url"
+	"strings"
+)
+
+// ErrUnsupportedType is returned by codecs which can't encode or decode a value of the given type
+var ErrUnsupportedType = errors.New("codec: unsupported type")
+
+// Codec encodes and decodes bodies of one media type
+type Codec interface {
+	// ContentType returns the media type of encoded bodies, e.g. "application/json"
+	ContentType() string
+
+	Marshal(v any) ([]byte, error)
+
+	Unmarshal(data []byte, v any) error
+}
+
+var (
+	// JSON encodes with encoding/json
+	JSON Codec = jsonCodec{}
+
+	// XML encodes with encoding/xml
+	XML Codec = xmlCodec{}
+
+	// Form encodes url.Values, map[string][]string and map[string]string as
+	// application/x-www-form-urlencoded
+	Form Codec = formCodec{}
+
+	// Text encodes strings, byte slices and encoding.TextMarshaler as text/plain
+	Text Codec = textCodec{}
+
+	// Bytes passes byte slices and strings through as application/octet-stream
+	Bytes Codec = bytesCodec{}
+)
+
+type jsonCodec struct{}
+
+func (jsonCodec) ContentType() string {
+	return "application/json"
+}
+
+func (jsonCodec) Marshal(v any) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+func (jsonCodec) Unmarshal(data []byte, v any) error {
+	return json.Unmarshal(data, v)
+}
+
+type xmlCodec struct{}
+
+func (xmlCodec) ContentType() string {
+	return "application/xml"
+}
+
+func (xmlCodec) Marshal(v any) ([]byte, error) {
+	return xml.Marshal(v)
+}
+
+func (xmlCodec) Unmarshal(data []byte, v any) error {
+	return xml.Unmarshal(data, v)
+}
+
+type formCodec struct{}
+
+func (formCodec) ContentType() string {
+	return "application/x-www-form-urlencoded"
+}
+
+func (formCodec) Marshal(v any) ([]byte, error) {
+	switch v := v.(type) {
+	case url.Values:
+		return []byte(v.Encode()), nil
+	case *url.Values:
+		return []byte(v.Encode()), nil
+	case map[string][]string:
+		return []byte(url.Values(v).Encode()), nil
+	case map[string]string:
+		values := make(url.Values, len(v))
+		for k, s := range v {
+			values.Set(k, s)
+		}
+
+		return []byte(values.Encode()), nil
+	}
+
+	return nil, fmt.Errorf("%w: %T", ErrUnsupportedType, v)
+}
+
+func (formCodec) Unmarshal(data []byte, v any) error {
+	values, err := url.ParseQuery(string(data))
+	if err != nil {
+		return err
+	}
+
+	switch v := v.(type) {
+	case *url.Values:
+		*v = values
+	case *map[string][]string:
+		*v = values
+	case *map[string]string:
+		*v = make(map[string]string, len(values))
+		for k := range values {
+			(*v)[k] = values.Get(k)
+		}
+	default:
+		return fmt.Errorf("%w: %T", ErrUnsupportedType, v)
+	}
+
+	return nil
+}
+
+type textCodec struct{}
+
+func (textCodec) ContentType() string {
+	return "text/plain; charset=utf-8"
+}
+
+func (textCodec) Marshal(v any) ([]byte, error) {
+	switch v := v.(type) {
+	case string:
+		return []byte(v), nil
+	case []byte:
+		return v, nil
+	case encoding.TextMarshaler:
+		return v.MarshalText()
+	case fmt.Stringer:
+		return []byte(v.String()), nil
+	}
+
+	return nil, fmt.Errorf("%w: %T", ErrUnsupportedType, v)
+}
+
+func (textCodec) Unmarshal(data []byte, v any) error {
+	switch v := v.(type) {
+	case *string:
+		*v = string(data)
+	case *[]byte:
+		*v = append((*v)[:0], data...)
+	case encoding.TextUnmarshaler:
+		return v.UnmarshalText(data)
+	default:
+		return fmt.Errorf("%w: %T", ErrUnsupportedType, v)
+	}
+
+	return nil
+}
+
+type bytesCodec struct{}
+
+func (bytesCodec) ContentType() string {
+	return "application/octet-stream"
+}
+
+func (bytesCodec) Marshal(v any) ([]byte, error) {
+	switch v := v.(type) {
+	case []byte:
+		return v, nil
+	case string:
+		return []byte(v), nil
+	}
+
+	return nil, fmt.Errorf("%w: %T", ErrUnsupportedType, v)
+}
+
+func (bytesCodec) Unmarshal(data []byte, v any) error {
+	switch v := v.(type) {
+	case *[]byte:
+		*v = append((*v)[:0], data...)
+	case *string:
+		*v = string(data)
+	default:
+		return fmt.Errorf("%w: %T", ErrUnsupportedType, v)
+	}
+
+	return nil
+}
+
+// Registry selects codecs by media type, the first codec is the default
+type Registry struct {
+	codecs []Codec
+}
+
+// NewRegistry returns a registry of the codecs, it panics without codecs
+func NewRegistry(codecs ...Codec) *Registry {
+	if len(codecs) == 0 {
+		panic("codec: NewRegistry requires at least one codec")
+	}
+
+	return &Registry{codecs: codecs}
+}
+
+// DefaultRegistry returns a registry of the built-in codecs with JSON as default
+func DefaultRegistry() *Registry {
+	return NewRegistry(JSON, XML, Form, Text, Bytes)
+}
+
+// Default returns the codec used for encoding and for responses without a known media type
+func (r *Registry) Default() Codec {
+	return r.codecs[0]
+}
+
+// DefaultAccept returns an Accept header value of the default codec's media type
+func (r *Registry) DefaultAccept() string {
+	return mediaType(r.Default().ContentType())
+}
+
+// Accept returns an Accept header value of every codec, preferring the default codec over the others
+func (r *Registry) Accept() string {
+	types := make([]string, len(r.codecs))
+	for i, c := range r.codecs {
+		types[i] = mediaType(c.ContentType())
+		if i > 0 {
+			types[i] += ";q=0.9"
+		}
+	}
+
+	return strings.Join(types, ", ")
+}
+
+// Lookup returns the codec of a Content-Type header value. Parameters are ignored and
+// structured syntax suffixes match their base type, e.g. "application/problem+json" matches JSON
+// and "text/xml" matches XML
+func (r *Registry) Lookup(contentType string) (Codec, bool) {
+	typ := mediaType(contentType)
+	if typ == "" {
+		return nil, false
+	}
+
+	for _, c := range r.codecs {
+		if mediaType(c.ContentType()) == typ {
+			return c, true
+		}
+	}
+
+	// match by subtype or suffix, e.g. +json or text/xml
+	suffix := subtypeSuffix(typ)
+
+	for _, c := range r.codecs {
+		if s := subtypeSuffix(mediaType(c.ContentType())); s == suffix && (s == "json" || s == "xml") {
+			return c, true
+		}
+	}
+
+	return nil, false
+}
+
+// For returns the codec of a Content-Type header value, the default codec if there is none
+func (r *Registry) For(contentType string) Codec {
+	if c, ok := r.Lookup(contentType); ok {
+		return c
+	}
+
+	return r.Default()
+}
+
+// mediaType returns the lower cased media type without parameters, "" if it can't be parsed
+func mediaType(contentType string) string {
+	typ, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return ""
+	}
+
+	return typ
+}
+
+// subtypeSuffix returns the structured syntax suffix of the media type, or its subtype
+func subtypeSuffix(typ string) string {
+	_, subtype, _ := strings.Cut(typ, "/")
+
+	if i := strings.LastIndexByte(subtype, '+'); i >= 0 {
+		return subtype[i+1:]
+	}
+
+	return subtype
+}
@@ -0,0 +1,84 @@
+package codec_test
+
+import (
+	"errors"
+	"net/url"
+	"testing"
+
+	"github.com/tanveerprottoy/stdlib-ext/httpext/codec"
+)
+
+func TestLookup(t *testing.T) {
+	r := codec.DefaultRegistry()
+
+	tests := []struct {
+		contentType string
+		want        codec.Codec
+	}{
+		{"application/json", codec.JSON},
+		{"application/json; charset=utf-8", codec.JSON},
+		{"application/problem+json", codec.JSON},
+		{"Application/XML", codec.XML},
+		{"text/xml; charset=utf-8", codec.XML},
+		{"application/atom+xml", codec.XML},
+		{"application/x-www-form-urlencoded", codec.Form},
+		{"text/plain", codec.Text},
+		{"application/octet-stream", codec.Bytes},
+		{"text/html", nil},
+		{"", nil},
+	}
+
+	for _, tt := range tests {
+		got, ok := r.Lookup(tt.contentType)
+		if got != tt.want || ok != (tt.want != nil) {
+			t.Errorf("Lookup(%q) = %v, %v, want %v", tt.contentType, got, ok, tt.want)
+		}
+	}
+
+	if r.For("text/html") != codec.JSON {
+		t.Errorf("expected the default codec for unknown media types")
+	}
+
+	if got := codec.NewRegistry(codec.XML, codec.JSON).Accept(); got != "application/xml, application/json;q=0.9" {
+		t.Errorf("unexpected Accept %q", got)
+	}
+
+	if got := codec.NewRegistry(codec.Text, codec.JSON).DefaultAccept(); got != "text/plain" {
+		t.Errorf("unexpected DefaultAccept %q", got)
+	}
+}
+
+func TestCodecs(t *testing.T) {
+	// subtest testForm
+	t.Run("testForm", func(t *testing.T) {
+		data, err := codec.Form.Marshal(map[string]string{"grant_type": "client_credentials", "scope": "a b"})
+		if err != nil || string(data) != "grant_type=client_credentials&scope=a+b" {
+			t.Fatalf("unexpected form %q, %v", data, err)
+		}
+
+		var values url.Values
+		if err := codec.Form.Unmarshal(data, &values); err != nil || values.Get("scope") != "a b" {
+			t.Errorf("unexpected values %v, %v", values, err)
+		}
+	})
+
+	// subtest testText
+	t.Run("testText", func(t *testing.T) {
+		var s string
+		if err := codec.Text.Unmarshal([]byte("pong"), &s); err != nil || s != "pong" {
+			t.Errorf("unexpected text %q, %v", s, err)
+		}
+	})
+
+	// subtest testUnsupportedType
+	t.Run("testUnsupportedType", func(t *testing.T) {
+		if _, err := codec.Form.Marshal(struct{}{}); !errors.Is(err, codec.ErrUnsupportedType) {
+			t.Errorf("expected ErrUnsupportedType, got %v", err)
+		}
+
+		var n int
+		if err := codec.Bytes.Unmarshal([]byte("1"), &n); !errors.Is(err, codec.ErrUnsupportedType) {
+			t.Errorf("expected ErrUnsupportedType, got %v", err)
+		}
+	})
+}
@@ -1,19 +1,32 @@
 package httpext
 
 import (
-	"bytes"
-	"io"
-	"log"
-	"math"
-	"math/rand"
+	"crypto/tls"
+	"errors"
+	"log/slog"
 	"net/http"
 	"time"
+
+	"github.com/tanveerprottoy/stdlib-ext/httpext/backoff"
+	"github.com/tanveerprottoy/stdlib-ext/httpext/metrics"
+	"github.com/tanveerprottoy/stdlib-ext/httpext/roundtripper/auth"
+	"github.com/tanveerprottoy/stdlib-ext/httpext/roundtripper/coalesce"
+	"github.com/tanveerprottoy/stdlib-ext/httpext/roundtripper/hedge"
+	"github.com/tanveerprottoy/stdlib-ext/httpext/roundtripper/retry"
+	"github.com/tanveerprottoy/stdlib-ext/httpext/roundtripper/timing"
+	"github.com/tanveerprottoy/stdlib-ext/httpext/roundtripper/tracing"
 )
 
 type Config struct {
 	MaxRetries int           // maximum number of retries for a request
 	MaxJitter  int           // maximum jitter in milliseconds
 	Timeout    time.Duration // request timeout
+
+	MaxRetryAfter  time.Duration // upper bound for delays requested through Retry-After/RateLimit-Reset headers
+	MaxElapsedTime time.Duration // total time budget for all attempts of a request, 0 means no limit
+
+	ReplayMemoryLimit int64 // bytes of a body without GetBody kept in memory for retries, larger bodies are spooled to a temp file
+	ReplayBodyLimit   int64 // maximum size of a body without GetBody that can be retried, larger bodies are sent once
 }
 
 type Option func(*customClient)
@@ -24,31 +37,148 @@ func WithCheckRedirectFunc(f func(req *http.Request, via []*http.Request) error)
 	}
 }
 
-func WithMaxIdleConnsPerHost(maxIdleConnsPerHost int) Option {
+// WithRetryPolicy sets the policy which decides whether a request is retried
+func WithRetryPolicy(p retry.Policy) Option {
+	return func(c *customClient) {
+		c.retryPolicy = p
+	}
+}
+
+// WithBackoff sets the strategy which computes the delay between attempts,
+// it replaces the default exponential backoff with MaxJitter
+func WithBackoff(s backoff.Strategy) Option {
+	return func(c *customClient) {
+		c.backoff = s
+	}
+}
+
+// WithClock sets the clock used to wait between attempts
+func WithClock(clock backoff.Clock) Option {
+	return func(c *customClient) {
+		c.clock = clock
+	}
+}
+
+// WithIdempotencyKey makes non-idempotent requests (e.g. POST, PATCH) retryable by
+// attaching a generated Idempotency-Key header which is stable across attempts.
+// Without it only idempotent requests are retried
+func WithIdempotencyKey(enabled bool) Option {
+	return func(c *customClient) {
+		c.idempotencyKey = enabled
+	}
+}
+
+// WithLogger sets the logger, slog.Default() by default
+func WithLogger(l *slog.Logger) Option {
+	return func(c *customClient) {
+		c.logger = l
+	}
+}
+
+// WithMetrics reports request counts, latencies, in-flight requests, retries and errors
+// per host and method to m, e.g. a metrics.Expvar
+func WithMetrics(m Metrics) Option {
+	return func(c *customClient) {
+		c.metrics = m
+	}
+}
+
+// WithAuth authenticates every request, e.g. with auth.Basic, auth.Bearer,
+// auth.APIKeyHeader, auth.APIKeyQuery or an auth.HMACSigner
+func WithAuth(a auth.Authenticator) Option {
+	return func(c *customClient) {
+		c.authenticators = append(c.authenticators, a)
+	}
+}
+
+// WithOAuth2 authenticates every request with a token from source,
+// refreshing it and retrying once when the server answers 401
+func WithOAuth2(source auth.TokenSource) Option {
+	return func(c *customClient) {
+		c.tokenSource = source
+	}
+}
+
+// WithCoalescing lets identical concurrent GET and HEAD requests share one upstream call,
+// keyHeaders replace coalesce.DefaultKeyHeaders when given
+func WithCoalescing(keyHeaders ...string) Option {
+	return func(c *customClient) {
+		c.coalesce = true
+		c.coalesceKeyHeaders = keyHeaders
+	}
+}
+
+// WithHedging sends a second identical request when an idempotent request hasn't answered
+// after a fixed or learned delay and takes the first response, see hedge.Config
+func WithHedging(cfg hedge.Config) Option {
 	return func(c *customClient) {
-		c.maxIdleConnsPerHost = maxIdleConnsPerHost
+		c.hedgeConfig = &cfg
 	}
 }
 
-func WithIdleConnTimeout(idleConnTimeout time.Duration) Option {
+// WithConnectionTimings traces every attempt with the timing round tripper, the DNS, connect,
+// TLS, time-to-first-byte and transfer durations are then available through timing.FromResponse
+// and reported to the Metrics set with WithMetrics. onDone, when not nil, receives the complete timings
+func WithConnectionTimings(onDone func(req *http.Request, t timing.Timings)) Option {
 	return func(c *customClient) {
-		c.idleConnTimeout = idleConnTimeout
+		c.timings = true
+		c.onTimings = onDone
+	}
+}
+
+// WithTracing creates a client span with t for every attempt and propagates the trace context
+// and baggage of the request context with the W3C traceparent, tracestate and baggage headers.
+// A nil t only propagates
+func WithTracing(t tracing.Tracer) Option {
+	return func(c *customClient) {
+		c.tracing = true
+		c.tracer = t
 	}
 }
 
 // customClient is a custom HTTP client that implements the Client interface
 type customClient struct {
 	httpClient *http.Client
+	retry      *retry.Executor
 	maxRetries int
 	maxJitter  int
 
-	// transport options
-	maxIdleConnsPerHost int
-	idleConnTimeout     time.Duration
+	maxRetryAfter  time.Duration
+	maxElapsedTime time.Duration
+	retryPolicy    retry.Policy
+	backoff        backoff.Strategy
+	clock          backoff.Clock
+	idempotencyKey bool
+	logger         *slog.Logger
+	metrics        Metrics
+
+	replayMemoryLimit int64
+	replayBodyLimit   int64
+
+	// authentication, applied on the transport so that every attempt is authenticated
+	authenticators []auth.Authenticator
+	tokenSource    auth.TokenSource
+
+	// request coalescing and hedging
+	coalesce           bool
+	coalesceKeyHeaders []string
+	hedgeConfig        *hedge.Config
+
+	// connection timings and tracing
+	timings   bool
+	onTimings func(req *http.Request, t timing.Timings)
+	tracing   bool
+	tracer    tracing.Tracer
+
+	// transport options, applied to a clone of http.DefaultTransport or of baseTransport
+	transportOpts []func(*http.Transport)
+	tlsConfig     *tls.Config // the TLS options are applied to a clone of it
+	baseTransport http.RoundTripper
+	configErr     error // set by options which failed, e.g. to load a certificate
 }
 
 func NewCustomClient(cfg Config, opts ...Option) *customClient {
-	// sanitize maxRetries, maxJitter and maxIdleConnsPerHost
+	// sanitize maxRetries, maxJitter and timeout, the retry executor sanitizes the rest
 	if cfg.MaxRetries <= 0 {
 		cfg.MaxRetries = 3
 	}
@@ -67,6 +197,12 @@ func NewCustomClient(cfg Config, opts ...Option) *customClient {
 		httpClient: httpClient,
 		maxRetries: cfg.MaxRetries,
 		maxJitter:  cfg.MaxJitter,
+
+		maxRetryAfter:  cfg.MaxRetryAfter,
+		maxElapsedTime: cfg.MaxElapsedTime,
+
+		replayMemoryLimit: cfg.ReplayMemoryLimit,
+		replayBodyLimit:   cfg.ReplayBodyLimit,
 	}
 
 	// apply options
@@ -74,133 +210,102 @@ func NewCustomClient(cfg Config, opts ...Option) *customClient {
 		opt(c)
 	}
 
-	// if one of the transport options is set, use the custom transport/roundtripper
-	if c.maxIdleConnsPerHost > 0 || c.idleConnTimeout > 0 {
-		httpClient.Transport = &http.Transport{
-			MaxIdleConnsPerHost: c.maxIdleConnsPerHost,
-			IdleConnTimeout:     c.idleConnTimeout,
-		}
+	if c.clock == nil {
+		c.clock = backoff.SystemClock()
 	}
 
-	return c
-}
+	if c.logger == nil {
+		c.logger = slog.Default()
+	}
 
-// backoff generates the backoff time in seconds based on the number of retries
-func (c *customClient) backoff(retries int) time.Duration {
-	// 2^n backoff, n = number of retries
-	return time.Duration(math.Pow(2, float64(retries))) * time.Second
-}
+	// the round trippers below wrap the transport, a nil transport means http.DefaultTransport
+	transport, err := c.transport()
+	httpClient.Transport = transport
+	c.configErr = errors.Join(c.configErr, err)
 
-// jitter generates a random jitter in milliseconds which is added to the backoff time
-func (c *customClient) jitter(max, attempts int) time.Duration {
-	rnd := rand.Intn(max)
+	if c.configErr != nil {
+		c.logger.Error("customClient: invalid configuration, requests will fail", slog.Any("error", c.configErr))
+		httpClient.Transport = errRoundTripper{err: c.configErr}
+	}
 
-	return time.Duration(int(attempts*rnd)) * time.Millisecond
-}
+	// the timing round tripper must wrap the transport directly to trace the connection
+	if c.timings {
+		opts := []timing.Option{timing.WithOnDone(c.onTimings)}
+		if c.metrics != nil {
+			opts = append(opts, timing.WithMetrics(c.metrics))
+		}
 
-func (c *customClient) restoreRequestBody(req *http.Request) error {
-	if req.Body == nil {
-		return nil
+		httpClient.Transport = timing.NewRoundTripper(httpClient.Transport, opts...)
 	}
 
-	// Read the body into a buffer
-	buf, err := io.ReadAll(req.Body)
-	if err != nil {
-		return err
+	// every attempt, including hedged ones, is measured on the transport
+	if c.metrics != nil {
+		httpClient.Transport = metrics.NewRoundTripper(c.metrics, httpClient.Transport)
+	} else {
+		c.metrics = metrics.Noop()
 	}
 
-	// Restore the body so it can be read again
-	// This is important because the body is an io.ReadCloser and can only be read once
-	req.Body = io.NopCloser(bytes.NewBuffer(buf))
-
-	return nil
-}
-
-func (c *customClient) isRetryableError(err error) bool {
-	if err == nil {
-		return false
+	// every attempt gets its own client span
+	if c.tracing {
+		httpClient.Transport = tracing.NewRoundTripper(c.tracer, httpClient.Transport)
 	}
 
-	// check if error is temporary
-	if errNet, ok := err.(interface{ Temporary() bool }); ok && errNet.Temporary() {
-		return true
+	// authenticators wrap the transport in reverse so that they run in the order given,
+	// e.g. a signer added last signs the query parameters of an API key added first.
+	// A nil transport is replaced by http.DefaultTransport
+	for i := len(c.authenticators) - 1; i >= 0; i-- {
+		httpClient.Transport = auth.NewRoundTripper(c.authenticators[i], httpClient.Transport)
 	}
 
-	return false
-}
-
-func (c *customClient) drainBody(resp *http.Response) {
-	// drain the response body to reuse the connection
-	// only do this if the response is not nil and the body is not nil
-	if resp != nil && resp.Body != nil {
-		io.Copy(io.Discard, resp.Body)
-		resp.Body.Close()
+	if c.tokenSource != nil {
+		httpClient.Transport = auth.NewOAuth2RoundTripper(c.tokenSource, httpClient.Transport)
 	}
-}
-
-func (c *customClient) doWithRetry(req *http.Request) (*http.Response, error) {
-	var (
-		attempts = 0
-		resp     *http.Response
-		err      error
-	)
-
-	for attempts < c.maxRetries {
-		log.Printf("customClient: doWithRetry called, attempt %d\n", attempts)
-
-		// reusing a request body can be a bit tricky because the
-		// io.ReadCloser interface, which is the type of r.Body in an
-		// http.Request, is designed for single consumption. Once you've read the body, the underlying reader is often at its end, and attempting to read it again will yield an empty result or an error.
-		// Always rewind/restore the request body when non-nil.
-		if req.Body != nil {
-			if err := c.restoreRequestBody(req); err != nil {
-				return nil, err
-			}
-		}
-
-		resp, err = c.httpClient.Do(req)
-
-		log.Printf("customClient: doWithRetry.httpClient.Do called, attempt %d, response: %v\nerr: %v\n", attempts, resp, err)
-
-		if err != nil {
-			log.Printf("customClient: doWithRetry.httpClient.Do if err != nil: %v\n", err)
-
-			// check if error is temporary
-			if c.isRetryableError(err) {
-				// temp
-				log.Printf("backoff: %v\njitter: %v\n", c.backoff(attempts), c.jitter(c.maxJitter, attempts))
-
-				// drain the response body to reuse the connection
-				c.drainBody(resp)
-
-				// wait for backoff time
-				time.Sleep(c.backoff(attempts) + c.jitter(c.maxJitter, attempts))
 
-				// continue to next attempt
-				continue
-			}
+	// every hedged request is authenticated on its own
+	if c.hedgeConfig != nil {
+		httpClient.Transport = hedge.NewRoundTripper(*c.hedgeConfig, httpClient.Transport, hedge.WithClock(c.clock))
+	}
 
-			return nil, err
+	// coalescing is outermost so that waiters share the authenticated call
+	if c.coalesce {
+		var opts []coalesce.Option
+		if len(c.coalesceKeyHeaders) > 0 {
+			opts = append(opts, coalesce.WithKeyHeaders(c.coalesceKeyHeaders...))
 		}
 
-		// increment attempts
-		attempts++
+		httpClient.Transport = coalesce.NewRoundTripper(httpClient.Transport, opts...)
+	}
 
-		log.Printf("customClient: doWithRetry after increment attempts: %d\n", attempts)
+	c.retry = &retry.Executor{
+		MaxRetries:        c.maxRetries,
+		Policy:            c.retryPolicy,
+		Backoff:           c.backoff,
+		Clock:             c.clock,
+		MaxRetryAfter:     c.maxRetryAfter,
+		MaxElapsedTime:    c.maxElapsedTime,
+		IdempotencyKey:    c.idempotencyKey,
+		ReplayMemoryLimit: c.replayMemoryLimit,
+		ReplayBodyLimit:   c.replayBodyLimit,
+		Logger:            c.logger,
+		Metrics:           c.metrics,
 	}
+	c.retry.Sanitize(time.Duration(c.maxJitter) * time.Millisecond)
 
-	return resp, nil
+	return c
+}
+
+func (c *customClient) doWithRetry(req *http.Request) (*http.Response, error) {
+	// every attempt goes through the http.Client, e.g. to follow redirects
+	return c.retry.Do(req, c.httpClient.Do)
 }
 
 func (c *customClient) doWithoutRetry(req *http.Request) (*http.Response, error) {
 	// do without retry
-	log.Println("customClient: doWithoutRetry called")
-
 	return c.httpClient.Do(req)
 }
 
 func (c *customClient) Do(req *http.Request, retry bool) (*http.Response, error) {
-	log.Println("customClient: Do called")
+	c.logger.DebugContext(req.Context(), "customClient: Do called", "method", req.Method, "url", req.URL.Redacted(), "retry", retry)
 	if retry {
 		return c.doWithRetry(req)
 	}
@@ -213,3 +318,9 @@ func (c *customClient) Do(req *http.Request, retry bool) (*http.Response, error)
 func (c *customClient) HTTPClient() *http.Client {
 	return c.httpClient
 }
+
+// Err returns the error of options which couldn't be applied, e.g. a CA file which couldn't be loaded.
+// Every request of a client with an error fails with it
+func (c *customClient) Err() error {
+	return c.configErr
+}
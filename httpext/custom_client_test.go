@@ -2,14 +2,31 @@ package httpext_test
 
 import (
 	"context"
+	"errors"
+	"io"
 	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
 	"github.com/tanveerprottoy/stdlib-ext/httpext"
+	"github.com/tanveerprottoy/stdlib-ext/httpext/backoff"
+	"github.com/tanveerprottoy/stdlib-ext/httpext/metrics"
+	"github.com/tanveerprottoy/stdlib-ext/httpext/roundtripper/auth"
+	"github.com/tanveerprottoy/stdlib-ext/httpext/roundtripper/hedge"
+	"github.com/tanveerprottoy/stdlib-ext/httpext/roundtripper/timing"
+	"github.com/tanveerprottoy/stdlib-ext/httpext/roundtripper/tracing"
 )
 
 func TestCustomClient(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer srv.Close()
+
 	cfg := httpext.Config{
 		MaxRetries: 5,
 		MaxJitter:  10,
@@ -29,7 +46,7 @@ func TestCustomClient(t *testing.T) {
 		defer cancel()
 
 		// Mock a request
-		req, err := http.NewRequestWithContext(ctx, http.MethodGet, "http://localhost:8080/api/v1/products", nil)
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, srv.URL+"/api/v1/products", nil)
 		if err != nil {
 			t.Errorf("failed to create request: %v", err)
 			return
@@ -52,4 +69,408 @@ func TestCustomClient(t *testing.T) {
 		}
 	})
 
+	// subtest testDoRetriesUnavailable
+	t.Run("testDoRetriesUnavailable", func(t *testing.T) {
+		var calls atomic.Int32
+
+		flaky := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if calls.Add(1) == 1 {
+				w.WriteHeader(http.StatusServiceUnavailable)
+				return
+			}
+			w.WriteHeader(http.StatusOK)
+		}))
+		defer flaky.Close()
+
+		req, err := http.NewRequest(http.MethodGet, flaky.URL, nil)
+		if err != nil {
+			t.Fatalf("failed to create request: %v", err)
+		}
+
+		resp, err := client.Do(req, true)
+		if err != nil {
+			t.Fatalf("client.Do error: %v", err)
+		}
+		defer resp.Body.Close()
+
+		if resp.StatusCode != http.StatusOK {
+			t.Errorf("expected status code 200, got %d", resp.StatusCode)
+		}
+
+		if calls.Load() != 2 {
+			t.Errorf("expected 2 calls, got %d", calls.Load())
+		}
+	})
+
+	// subtest testMetrics
+	t.Run("testMetrics", func(t *testing.T) {
+		var calls atomic.Int32
+
+		flaky := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if calls.Add(1) == 1 {
+				w.WriteHeader(http.StatusServiceUnavailable)
+				return
+			}
+			w.WriteHeader(http.StatusOK)
+		}))
+		defer flaky.Close()
+
+		m := metrics.NewExpvar("")
+		client := httpext.NewCustomClient(cfg, httpext.WithMetrics(m))
+
+		req, _ := http.NewRequest(http.MethodGet, flaky.URL, nil)
+
+		resp, err := client.Do(req, true)
+		if err != nil {
+			t.Fatalf("client.Do error: %v", err)
+		}
+		resp.Body.Close()
+
+		var b strings.Builder
+		m.WritePrometheus(&b)
+
+		host := strings.TrimPrefix(flaky.URL, "http://")
+
+		for _, line := range []string{
+			`httpext_requests_total{host="` + host + `",method="GET",class="2xx"} 1`,
+			`httpext_requests_total{host="` + host + `",method="GET",class="5xx"} 1`,
+			`httpext_retries_total{host="` + host + `",method="GET"} 1`,
+		} {
+			if !strings.Contains(b.String(), line) {
+				t.Errorf("expected line %q in:\n%s", line, b.String())
+			}
+		}
+	})
+}
+
+func TestAuthOrder(t *testing.T) {
+	signer := auth.NewHMACSigner("key-1", []byte("secret"), time.Now)
+
+	var verifyErr error
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("api_key") == "" {
+			verifyErr = errors.New("missing api_key")
+			return
+		}
+
+		verifyErr = signer.Verify(r, time.Minute)
+	}))
+	defer srv.Close()
+
+	// the signature has to cover the API key added before it
+	client := httpext.NewCustomClient(
+		httpext.Config{},
+		httpext.WithAuth(auth.APIKeyQuery("api_key", "k1")),
+		httpext.WithAuth(signer),
+	)
+
+	req, _ := http.NewRequest(http.MethodGet, srv.URL+"/orders", nil)
+
+	resp, err := client.Do(req, false)
+	if err != nil {
+		t.Fatalf("client.Do error: %v", err)
+	}
+	resp.Body.Close()
+
+	if verifyErr != nil {
+		t.Errorf("expected the authenticators to run in order: %v", verifyErr)
+	}
+}
+
+func TestCoalescingWithTimings(t *testing.T) {
+	var calls atomic.Int32
+
+	release := make(chan struct{})
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		<-release
+		w.Write([]byte("payload"))
+	}))
+	defer srv.Close()
+
+	exporter := tracing.NewInMemoryExporter()
+
+	client := httpext.NewCustomClient(
+		httpext.Config{},
+		httpext.WithCoalescing(),
+		httpext.WithConnectionTimings(nil),
+		httpext.WithTracing(tracing.NewTracer(exporter)),
+	)
+
+	// the first caller relies on FromResponse, the second one joins its call with its own recorder
+	ctx, recorder := timing.WithRecorder(context.Background())
+
+	var (
+		wg    sync.WaitGroup
+		first timing.Timings
+		ok    bool
+	)
+
+	for i, ctx := range []context.Context{context.Background(), ctx} {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			req, _ := http.NewRequestWithContext(ctx, http.MethodGet, srv.URL, nil)
+
+			resp, err := client.Do(req, false)
+			if err != nil {
+				t.Errorf("client.Do error: %v", err)
+				return
+			}
+			io.Copy(io.Discard, resp.Body)
+			resp.Body.Close()
+
+			if i == 0 {
+				first, ok = timing.FromResponse(resp)
+			}
+		}()
+
+		// the second request joins the call of the first one
+		time.Sleep(50 * time.Millisecond)
+	}
+
+	close(release)
+	wg.Wait()
+
+	if calls.Load() != 1 {
+		t.Fatalf("expected 1 upstream call, got %d", calls.Load())
+	}
+
+	if !ok || first.TimeToFirstByte <= 0 {
+		t.Errorf("expected the timings of the shared call through FromResponse, got %+v", first)
+	}
+
+	if recorder.Timings().TimeToFirstByte <= 0 {
+		t.Errorf("expected the timings of the shared call in the caller's recorder, got %+v", recorder.Timings())
+	}
+
+	// the shared call is traced once, below the coalescing round tripper
+	if spans := exporter.Spans(); len(spans) != 1 {
+		t.Errorf("expected 1 span, got %d", len(spans))
+	}
+}
+
+// tokenSource hands out token-1 until it's refreshed and token-2 after
+type tokenSource struct {
+	refreshed atomic.Bool
+}
+
+func (s *tokenSource) Token(context.Context) (*auth.Token, error) {
+	if s.refreshed.Load() {
+		return &auth.Token{AccessToken: "token-2"}, nil
+	}
+
+	return &auth.Token{AccessToken: "token-1"}, nil
+}
+
+func (s *tokenSource) Refresh(context.Context, *auth.Token) (*auth.Token, error) {
+	s.refreshed.Store(true)
+	return &auth.Token{AccessToken: "token-2"}, nil
+}
+
+// waitForSpans waits until n spans were exported, losing attempts end theirs after the winner returned
+func waitForSpans(t *testing.T, exporter *tracing.InMemoryExporter, n int) []tracing.SpanData {
+	t.Helper()
+
+	for range 100 {
+		if spans := exporter.Spans(); len(spans) >= n {
+			return spans
+		}
+
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	spans := exporter.Spans()
+	t.Fatalf("expected %d spans, got %d", n, len(spans))
+
+	return spans
+}
+
+func TestHedgingWithOAuth2(t *testing.T) {
+	var (
+		calls   atomic.Int32
+		headers = make(chan http.Header, 2)
+	)
+
+	// the first attempt hangs until it's canceled, the hedged one answers
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		headers <- r.Header.Clone()
+
+		if calls.Add(1) == 1 {
+			<-r.Context().Done()
+			return
+		}
+
+		w.Write([]byte("payload"))
+	}))
+	defer srv.Close()
+
+	exporter := tracing.NewInMemoryExporter()
+
+	client := httpext.NewCustomClient(
+		httpext.Config{},
+		httpext.WithHedging(hedge.Config{Delay: 50 * time.Millisecond}),
+		httpext.WithOAuth2(&tokenSource{}),
+		httpext.WithConnectionTimings(nil),
+		httpext.WithTracing(tracing.NewTracer(exporter)),
+	)
+
+	req, _ := http.NewRequest(http.MethodGet, srv.URL, nil)
+
+	resp, err := client.Do(req, false)
+	if err != nil {
+		t.Fatalf("client.Do error: %v", err)
+	}
+	io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+
+	// the timings are those of the hedged attempt, the first one never got a response
+	if tm, ok := timing.FromResponse(resp); !ok || tm.TimeToFirstByte <= 0 {
+		t.Errorf("expected the timings of the winning attempt, got %+v", tm)
+	}
+
+	// every attempt is authenticated and traced on its own
+	first, hedged := <-headers, <-headers
+
+	for _, h := range []http.Header{first, hedged} {
+		if got := h.Get("Authorization"); got != "Bearer token-1" {
+			t.Errorf("expected every attempt to be authenticated, got %q", got)
+		}
+	}
+
+	if first.Get("Traceparent") == "" || first.Get("Traceparent") == hedged.Get("Traceparent") {
+		t.Errorf("expected a span per attempt, got traceparent %q and %q", first.Get("Traceparent"), hedged.Get("Traceparent"))
+	}
+
+	spans := waitForSpans(t, exporter, 2)
+
+	var failed int
+	for _, span := range spans {
+		if span.Status == tracing.StatusError {
+			failed++
+		}
+	}
+
+	if failed != 1 {
+		t.Errorf("expected the span of the canceled attempt to fail, got %d failed spans", failed)
+	}
+}
+
+func TestOAuth2WithTracing(t *testing.T) {
+	// the api only accepts the refreshed token
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer token-2" {
+			w.WriteHeader(http.StatusUnauthorized)
+		}
+	}))
+	defer srv.Close()
+
+	exporter := tracing.NewInMemoryExporter()
+
+	client := httpext.NewCustomClient(
+		httpext.Config{},
+		httpext.WithOAuth2(&tokenSource{}),
+		httpext.WithTracing(tracing.NewTracer(exporter)),
+	)
+
+	req, _ := http.NewRequest(http.MethodGet, srv.URL, nil)
+
+	resp, err := client.Do(req, false)
+	if err != nil {
+		t.Fatalf("client.Do error: %v", err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected the retry after refresh to succeed, got %d", resp.StatusCode)
+	}
+
+	// the rejected request and its retry are traced apart
+	spans := waitForSpans(t, exporter, 2)
+
+	for i, want := range []int64{http.StatusUnauthorized, http.StatusOK} {
+		if got, _ := spans[i].Attr("http.response.status_code"); got.Int64() != want {
+			t.Errorf("span %d: expected status code %d, got %v", i, want, got)
+		}
+	}
+}
+
+func TestConnectionTimingsWithRetries(t *testing.T) {
+	var calls atomic.Int32
+
+	flaky := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer flaky.Close()
+
+	var reported atomic.Int32
+
+	client := httpext.NewCustomClient(
+		httpext.Config{},
+		httpext.WithBackoff(backoff.NewConstant(0)),
+		httpext.WithConnectionTimings(func(*http.Request, timing.Timings) {
+			reported.Add(1)
+		}),
+	)
+
+	ctx, recorder := timing.WithRecorder(context.Background())
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, flaky.URL, nil)
+
+	resp, err := client.Do(req, true)
+	if err != nil {
+		t.Fatalf("client.Do error: %v", err)
+	}
+	resp.Body.Close()
+
+	// the timing round tripper sits below the retries, every attempt is reported
+	if reported.Load() != 2 {
+		t.Errorf("expected the timings of 2 attempts, got %d", reported.Load())
+	}
+
+	if recorder.Timings().TimeToFirstByte <= 0 {
+		t.Errorf("expected the recorder to keep the timings of the last attempt, got %+v", recorder.Timings())
+	}
+}
+
+func TestTracingWithRetries(t *testing.T) {
+	var calls atomic.Int32
+
+	flaky := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer flaky.Close()
+
+	exporter := tracing.NewInMemoryExporter()
+	tracer := tracing.NewTracer(exporter)
+
+	client := httpext.NewCustomClient(
+		httpext.Config{},
+		httpext.WithBackoff(backoff.NewConstant(0)),
+		httpext.WithTracing(tracer),
+	)
+
+	ctx, parent := tracer.Start(context.Background(), "operation")
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, flaky.URL, nil)
+
+	resp, err := client.Do(req, true)
+	if err != nil {
+		t.Fatalf("client.Do error: %v", err)
+	}
+	resp.Body.Close()
+
+	// every attempt gets a client span below the caller's span
+	spans := waitForSpans(t, exporter, 2)
+
+	for i, span := range spans {
+		if span.SpanContext.TraceID != parent.SpanContext().TraceID || span.Parent.SpanID != parent.SpanContext().SpanID {
+			t.Errorf("span %d: expected a child of the caller's span, got parent %v", i, span.Parent)
+		}
+	}
 }
@@ -0,0 +1,91 @@
+package httpext
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+
+	"github.com/tanveerprottoy/stdlib-ext/httpext/roundtripper/retry"
+)
+
+// maxErrorBodySize limits the raw body kept by an HTTPError
+const maxErrorBodySize = 1 << 20
+
+// HTTPError is returned by the service for responses with a non-2xx status code,
+// use errors.As to access it and ErrorBody to get the decoded error body
+type HTTPError struct {
+	Method     string      // method of the request
+	URL        string      // URL of the request without its password and with sensitive query values redacted
+	StatusCode int         // status code of the response, e.g. 404
+	Status     string      // status of the response, e.g. "404 Not Found"
+	Header     http.Header // headers of the response
+	Body       []byte      // raw body of the response, truncated to 1 MiB
+	Decoded    any         // body decoded to *E, nil if it was empty or couldn't be decoded
+	DecodeErr  error       // error decoding the body, nil if it was decoded or empty
+}
+
+func (e *HTTPError) Error() string {
+	return fmt.Sprintf("httpext: %s %s: %s", e.Method, e.URL, e.Status)
+}
+
+// ErrorBody returns the decoded error body of an HTTPError in err's chain
+func ErrorBody[E any](err error) (*E, bool) {
+	var httpErr *HTTPError
+	if !errors.As(err, &httpErr) {
+		return nil, false
+	}
+
+	e, ok := httpErr.Decoded.(*E)
+
+	return e, ok
+}
+
+// errorStatusCode returns the status code of an HTTPError in err's chain, 0 if there is none
+func errorStatusCode(err error) int {
+	var httpErr *HTTPError
+	if errors.As(err, &httpErr) {
+		return httpErr.StatusCode
+	}
+
+	return 0
+}
+
+// IsNotFound reports whether err is an HTTPError with status 404
+func IsNotFound(err error) bool {
+	return errorStatusCode(err) == http.StatusNotFound
+}
+
+// IsUnauthorized reports whether err is an HTTPError with status 401
+func IsUnauthorized(err error) bool {
+	return errorStatusCode(err) == http.StatusUnauthorized
+}
+
+// IsRetryable reports whether the request may succeed when sent again, i.e. err is an HTTPError the
+// default retry policy retries or a transient transport error, see retry.IsRetryableError
+func IsRetryable(err error) bool {
+	var httpErr *HTTPError
+	if errors.As(err, &httpErr) {
+		resp := &http.Response{StatusCode: httpErr.StatusCode, Header: httpErr.Header}
+		return retry.DefaultPolicy().ShouldRetry(nil, resp, nil)
+	}
+
+	return retry.IsRetryableError(err)
+}
+
+// IsTimeout reports whether err is a timeout, either an HTTPError with status 408 or 504,
+// an expired context or a network timeout
+func IsTimeout(err error) bool {
+	if code := errorStatusCode(err); code == http.StatusRequestTimeout || code == http.StatusGatewayTimeout {
+		return true
+	}
+
+	if errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+
+	var netErr net.Error
+
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
@@ -0,0 +1,133 @@
+package httpext_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/tanveerprottoy/stdlib-ext/httpext"
+)
+
+type product struct {
+	ID string `json:"id"`
+}
+
+type apiError struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+func TestHTTPError(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/missing", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte(`{"code":"not_found","message":"no such product"}`))
+	})
+	mux.HandleFunc("/proxy", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		w.WriteHeader(http.StatusServiceUnavailable)
+		w.Write([]byte("<html>upstream unavailable</html>"))
+	})
+	mux.HandleFunc("/login", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusUnauthorized)
+	})
+
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	s := httpext.NewService[product, apiError](httpext.NewCustomClient(httpext.Config{}))
+
+	// subtest testDecodedErrorBody
+	t.Run("testDecodedErrorBody", func(t *testing.T) {
+		_, e, err := s.Request(context.Background(), http.MethodGet, srv.URL+"/missing", nil, nil, false)
+
+		var httpErr *httpext.HTTPError
+		if !errors.As(err, &httpErr) {
+			t.Fatalf("expected *HTTPError, got %v", err)
+		}
+
+		if httpErr.Method != http.MethodGet || httpErr.URL != srv.URL+"/missing" || httpErr.Header.Get("Content-Type") != "application/json" {
+			t.Errorf("unexpected request or response details %+v", httpErr)
+		}
+
+		if e == nil || e.Code != "not_found" {
+			t.Errorf("expected the decoded error body, got %+v", e)
+		}
+
+		if body, ok := httpext.ErrorBody[apiError](err); !ok || body != e {
+			t.Errorf("expected ErrorBody to return the decoded error body")
+		}
+
+		if !httpext.IsNotFound(err) || httpext.IsUnauthorized(err) || httpext.IsRetryable(err) {
+			t.Errorf("unexpected classification of a 404")
+		}
+	})
+
+	// subtest testUndecodableErrorBody
+	t.Run("testUndecodableErrorBody", func(t *testing.T) {
+		_, e, err := s.Request(context.Background(), http.MethodGet, srv.URL+"/proxy", nil, nil, false)
+
+		var httpErr *httpext.HTTPError
+		if !errors.As(err, &httpErr) {
+			t.Fatalf("expected *HTTPError, got %v", err)
+		}
+
+		if e != nil || httpErr.DecodeErr == nil {
+			t.Errorf("expected the decode error to be recorded")
+		}
+
+		if string(httpErr.Body) != "<html>upstream unavailable</html>" {
+			t.Errorf("expected the raw body, got %q", httpErr.Body)
+		}
+
+		if !httpext.IsRetryable(err) {
+			t.Errorf("expected a 503 to be retryable")
+		}
+	})
+
+	// subtest testURLIsRedacted
+	t.Run("testURLIsRedacted", func(t *testing.T) {
+		u, _ := url.Parse(srv.URL + "/login?api_key=secret&page=2")
+		u.User = url.UserPassword("user", "password")
+
+		_, _, err := s.Request(context.Background(), http.MethodGet, u.String(), nil, nil, false)
+
+		var httpErr *httpext.HTTPError
+		if !errors.As(err, &httpErr) {
+			t.Fatalf("expected *HTTPError, got %v", err)
+		}
+
+		if msg := err.Error(); strings.Contains(msg, "secret") || strings.Contains(msg, "password") || !strings.Contains(msg, "page=2") {
+			t.Errorf("expected the password and API key to be redacted, got %s", msg)
+		}
+	})
+
+	// subtest testEmptyErrorBody
+	t.Run("testEmptyErrorBody", func(t *testing.T) {
+		_, _, err := s.Request(context.Background(), http.MethodGet, srv.URL+"/login", nil, nil, false)
+
+		if !httpext.IsUnauthorized(err) {
+			t.Errorf("expected IsUnauthorized, got %v", err)
+		}
+
+		if _, ok := httpext.ErrorBody[apiError](err); ok {
+			t.Errorf("expected no decoded error body")
+		}
+	})
+
+	// subtest testTimeout
+	t.Run("testTimeout", func(t *testing.T) {
+		if !httpext.IsTimeout(&httpext.HTTPError{StatusCode: http.StatusGatewayTimeout}) || !httpext.IsTimeout(context.DeadlineExceeded) {
+			t.Errorf("expected a timeout")
+		}
+
+		if httpext.IsTimeout(&httpext.HTTPError{StatusCode: http.StatusBadGateway}) {
+			t.Errorf("expected a 502 not to be a timeout")
+		}
+	})
+}
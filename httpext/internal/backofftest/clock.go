@@ -0,0 +1,86 @@
+// Package backofftest provides a fake backoff.Clock for tests
+package backofftest
+
+import (
+	"sync"
+	"time"
+)
+
+// Clock is a backoff.Clock which only moves when told to, After advances it by the duration
+// at once unless Manual is set. Every call to Now advances it by Step first. It's safe for concurrent use
+type Clock struct {
+	Step time.Duration
+
+	// Manual makes After wait until Advance moves the clock past its deadline,
+	// which lets tests queue several waiters
+	Manual bool
+
+	mu      sync.Mutex
+	now     time.Time
+	waiters []waiter
+}
+
+type waiter struct {
+	deadline time.Time
+	ch       chan time.Time
+}
+
+// NewClock returns a Clock starting at now
+func NewClock(now time.Time) *Clock {
+	return &Clock{now: now}
+}
+
+func (c *Clock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.now = c.now.Add(c.Step)
+
+	return c.now
+}
+
+func (c *Clock) After(d time.Duration) <-chan time.Time {
+	ch := make(chan time.Time, 1)
+
+	if !c.Manual {
+		ch <- c.Advance(d)
+		return ch
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.waiters = append(c.waiters, waiter{deadline: c.now.Add(d), ch: ch})
+
+	return ch
+}
+
+// Advance moves the clock forward by d, fires the waiters whose deadline passed
+// and returns the new time
+func (c *Clock) Advance(d time.Duration) time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.now = c.now.Add(d)
+
+	pending := c.waiters[:0]
+	for _, w := range c.waiters {
+		if w.deadline.After(c.now) {
+			pending = append(pending, w)
+			continue
+		}
+
+		w.ch <- c.now
+	}
+	c.waiters = pending
+
+	return c.now
+}
+
+// Waiters returns the number of After calls waiting for Advance
+func (c *Clock) Waiters() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return len(c.waiters)
+}
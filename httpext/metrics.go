@@ -0,0 +1,8 @@
+package httpext
+
+import "github.com/tanveerprottoy/stdlib-ext/httpext/metrics"
+
+// Metrics receives request counts, latencies, in-flight requests, retries and errors per host and method.
+// It's defined in the metrics package so that the round trippers can report to it as well,
+// metrics.Noop, metrics.NewExpvar and (*metrics.Expvar).WritePrometheus provide the implementations
+type Metrics = metrics.Metrics
@@ -0,0 +1,205 @@
+package metrics
+
+import (
+	"encoding/json"
+	"expvar"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultBuckets are the upper bounds in seconds of the latency histogram buckets
+var DefaultBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// Expvar is a Metrics backed by expvar variables, keyed by label strings such as
+// host=example.com,method=GET. Use WritePrometheus or Handler to expose it to Prometheus
+type Expvar struct {
+	root *expvar.Map
+
+	requests  *expvar.Map // host, method, class
+	errors    *expvar.Map // host, method, kind
+	retries   *expvar.Map // host, method
+	inFlight  *expvar.Map // host, method
+	durations *expvar.Map // host, method
+	phases    *expvar.Map // host, method, phase
+
+	buckets []float64
+
+	mu sync.Mutex // serializes the creation of histograms
+}
+
+// NewExpvar creates a new Expvar published under name, an empty name skips publishing.
+// buckets are the latency histogram bounds in seconds, DefaultBuckets when empty
+func NewExpvar(name string, buckets ...float64) *Expvar {
+	if len(buckets) == 0 {
+		buckets = DefaultBuckets
+	}
+
+	buckets = slices.Clone(buckets)
+	slices.Sort(buckets)
+
+	e := &Expvar{
+		root:      new(expvar.Map).Init(),
+		requests:  new(expvar.Map).Init(),
+		errors:    new(expvar.Map).Init(),
+		retries:   new(expvar.Map).Init(),
+		inFlight:  new(expvar.Map).Init(),
+		durations: new(expvar.Map).Init(),
+		phases:    new(expvar.Map).Init(),
+		buckets:   buckets,
+	}
+
+	e.root.Set("requests_total", e.requests)
+	e.root.Set("errors_total", e.errors)
+	e.root.Set("retries_total", e.retries)
+	e.root.Set("requests_in_flight", e.inFlight)
+	e.root.Set("request_duration_seconds", e.durations)
+	e.root.Set("phase_duration_seconds", e.phases)
+
+	if name != "" {
+		expvar.Publish(name, e.root)
+	}
+
+	return e
+}
+
+// Var returns the expvar variable holding every metric
+func (e *Expvar) Var() expvar.Var {
+	return e.root
+}
+
+func (e *Expvar) RequestStarted(host, method string) {
+	e.inFlight.Add(labels("host", host, "method", method), 1)
+}
+
+func (e *Expvar) RequestDone(host, method string, status int, duration time.Duration, err error) {
+	key := labels("host", host, "method", method)
+
+	e.inFlight.Add(key, -1)
+	e.requests.Add(labels("host", host, "method", method, "class", StatusClass(status, err)), 1)
+
+	if err != nil {
+		e.errors.Add(labels("host", host, "method", method, "kind", ErrorKind(err)), 1)
+	}
+
+	e.histogram(e.durations, key).observe(duration.Seconds())
+}
+
+// ObservePhase records the duration of a connection phase such as dns, connect, tls,
+// ttfb or transfer, it's called by the timing round tripper
+func (e *Expvar) ObservePhase(host, method, phase string, d time.Duration) {
+	e.histogram(e.phases, labels("host", host, "method", method, "phase", phase)).observe(d.Seconds())
+}
+
+func (e *Expvar) Retried(host, method string, attempt int) {
+	e.retries.Add(labels("host", host, "method", method), 1)
+}
+
+func (e *Expvar) histogram(m *expvar.Map, key string) *histogram {
+	if h, ok := m.Get(key).(*histogram); ok {
+		return h
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if h, ok := m.Get(key).(*histogram); ok {
+		return h
+	}
+
+	h := &histogram{bounds: e.buckets, counts: make([]uint64, len(e.buckets))}
+	m.Set(key, h)
+
+	return h
+}
+
+// labels joins name value pairs into a key, values are quoted when they contain separators
+func labels(pairs ...string) string {
+	var b strings.Builder
+
+	for i := 0; i < len(pairs); i += 2 {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+
+		value := pairs[i+1]
+		if strings.ContainsAny(value, `,="\`) {
+			value = strconv.Quote(value)
+		}
+
+		b.WriteString(pairs[i] + "=" + value)
+	}
+
+	return b.String()
+}
+
+// parseLabels splits a key built by labels into its name value pairs
+func parseLabels(key string) [][2]string {
+	var pairs [][2]string
+
+	for key != "" {
+		name, rest, _ := strings.Cut(key, "=")
+
+		var value string
+		if strings.HasPrefix(rest, `"`) {
+			quoted, err := strconv.QuotedPrefix(rest)
+			if err != nil {
+				return pairs
+			}
+
+			value, _ = strconv.Unquote(quoted)
+			rest = rest[len(quoted):]
+		} else {
+			value, rest, _ = strings.Cut(rest, ",")
+			rest = "," + rest
+		}
+
+		pairs = append(pairs, [2]string{name, value})
+		key = strings.TrimPrefix(rest, ",")
+	}
+
+	return pairs
+}
+
+// histogram is an expvar.Var counting observations per bucket, the counts are not cumulative
+type histogram struct {
+	mu     sync.Mutex
+	bounds []float64
+	counts []uint64 // observations <= bounds[i] and > bounds[i-1]
+	count  uint64
+	sum    float64
+}
+
+func (h *histogram) observe(v float64) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if i, _ := slices.BinarySearch(h.bounds, v); i < len(h.bounds) {
+		h.counts[i]++
+	}
+
+	h.count++
+	h.sum += v
+}
+
+type histogramSnapshot struct {
+	Bounds []float64 `json:"bounds"`
+	Counts []uint64  `json:"counts"`
+	Count  uint64    `json:"count"`
+	Sum    float64   `json:"sum"`
+}
+
+func (h *histogram) snapshot() histogramSnapshot {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	return histogramSnapshot{Bounds: h.bounds, Counts: slices.Clone(h.counts), Count: h.count, Sum: h.sum}
+}
+
+// String implements expvar.Var
+func (h *histogram) String() string {
+	b, _ := json.Marshal(h.snapshot())
+	return string(b)
+}
@@ -0,0 +1,103 @@
+// Package metrics provides request metrics for httpext clients and round trippers
+package metrics
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Metrics receives the measurements of HTTP clients, implementations must be safe for concurrent use
+type Metrics interface {
+	// RequestStarted is called before a request is sent
+	RequestStarted(host, method string)
+
+	// RequestDone is called when the response headers arrived or the request failed,
+	// status is 0 when err is not nil
+	RequestDone(host, method string, status int, duration time.Duration, err error)
+
+	// Retried is called before attempt, counting from 1, of a retried request is sent
+	Retried(host, method string, attempt int)
+}
+
+type noop struct{}
+
+func (noop) RequestStarted(string, string)                         {}
+func (noop) RequestDone(string, string, int, time.Duration, error) {}
+func (noop) Retried(string, string, int)                           {}
+
+// Noop returns a Metrics which discards every measurement
+func Noop() Metrics {
+	return noop{}
+}
+
+// StatusClass returns the class of a status code, e.g. 2xx, or "error" for failed requests
+func StatusClass(status int, err error) string {
+	if err != nil || status < 100 || status > 599 {
+		return "error"
+	}
+
+	return strconv.Itoa(status/100) + "xx"
+}
+
+// ErrorKind classifies a request error as canceled, timeout or transport
+func ErrorKind(err error) string {
+	if errors.Is(err, context.Canceled) {
+		return "canceled"
+	}
+
+	var netErr net.Error
+	if errors.Is(err, context.DeadlineExceeded) || (errors.As(err, &netErr) && netErr.Timeout()) {
+		return "timeout"
+	}
+
+	return "transport"
+}
+
+// RoundTripper reports every request it sends to a Metrics
+type RoundTripper struct {
+	metrics Metrics
+
+	base http.RoundTripper
+}
+
+// NewRoundTripper creates a new metrics RoundTripper.
+// If base is nil, http.DefaultTransport is used.
+func NewRoundTripper(m Metrics, base http.RoundTripper) *RoundTripper {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+
+	return &RoundTripper{metrics: m, base: base}
+}
+
+// Middleware returns a roundtripper.Middleware which wraps its base with a metrics RoundTripper
+func Middleware(m Metrics) func(http.RoundTripper) http.RoundTripper {
+	return func(base http.RoundTripper) http.RoundTripper {
+		return NewRoundTripper(m, base)
+	}
+}
+
+func (rt *RoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	host, method := req.URL.Host, req.Method
+	if method == "" {
+		method = http.MethodGet
+	}
+
+	rt.metrics.RequestStarted(host, method)
+
+	start := time.Now()
+	resp, err := rt.base.RoundTrip(req)
+
+	status := 0
+	if err == nil {
+		status = resp.StatusCode
+	}
+
+	rt.metrics.RequestDone(host, method, status, time.Since(start), err)
+
+	return resp, err
+}
@@ -0,0 +1,103 @@
+package metrics_test
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/tanveerprottoy/stdlib-ext/httpext/metrics"
+)
+
+func TestExpvar(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/missing" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer srv.Close()
+
+	m := metrics.NewExpvar("", 0.5, 1)
+	rt := metrics.NewRoundTripper(m, nil)
+
+	for _, path := range []string{"/", "/", "/missing"} {
+		req, _ := http.NewRequest(http.MethodGet, srv.URL+path, nil)
+
+		resp, err := rt.RoundTrip(req)
+		if err != nil {
+			t.Fatalf("RoundTrip error: %v", err)
+		}
+		resp.Body.Close()
+	}
+
+	m.Retried("example.com", http.MethodPost, 1)
+	m.RequestStarted("example.com", http.MethodPost)
+	m.RequestDone("example.com", http.MethodPost, 0, 2*time.Second, errors.New("connection reset"))
+
+	var b strings.Builder
+	if err := m.WritePrometheus(&b); err != nil {
+		t.Fatalf("WritePrometheus error: %v", err)
+	}
+
+	host := strings.TrimPrefix(srv.URL, "http://")
+
+	for _, line := range []string{
+		"# TYPE httpext_requests_total counter",
+		`httpext_requests_total{host="` + host + `",method="GET",class="2xx"} 2`,
+		`httpext_requests_total{host="` + host + `",method="GET",class="4xx"} 1`,
+		`httpext_requests_total{host="example.com",method="POST",class="error"} 1`,
+		`httpext_errors_total{host="example.com",method="POST",kind="transport"} 1`,
+		`httpext_retries_total{host="example.com",method="POST"} 1`,
+		`httpext_requests_in_flight{host="` + host + `",method="GET"} 0`,
+		"# TYPE httpext_request_duration_seconds histogram",
+		`httpext_request_duration_seconds_bucket{host="` + host + `",method="GET",le="1"} 3`,
+		`httpext_request_duration_seconds_bucket{host="example.com",method="POST",le="1"} 0`,
+		`httpext_request_duration_seconds_bucket{host="example.com",method="POST",le="+Inf"} 1`,
+		`httpext_request_duration_seconds_count{host="example.com",method="POST"} 1`,
+		`httpext_request_duration_seconds_sum{host="example.com",method="POST"} 2`,
+	} {
+		if !strings.Contains(b.String(), line+"\n") {
+			t.Errorf("expected line %q in:\n%s", line, b.String())
+		}
+	}
+
+	if !strings.Contains(m.Var().String(), `"requests_total"`) {
+		t.Errorf("expected the expvar to contain requests_total, got %s", m.Var().String())
+	}
+}
+
+func TestPrometheusEscapesLabels(t *testing.T) {
+	m := metrics.NewExpvar("")
+	m.Retried(`a"b,c=d`, http.MethodGet, 1)
+
+	var b strings.Builder
+	m.WritePrometheus(&b)
+
+	if line := `httpext_retries_total{host="a\"b,c=d",method="GET"} 1`; !strings.Contains(b.String(), line) {
+		t.Errorf("expected line %q in:\n%s", line, b.String())
+	}
+}
+
+func TestStatusClass(t *testing.T) {
+	tests := []struct {
+		status int
+		err    error
+		want   string
+	}{
+		{http.StatusOK, nil, "2xx"},
+		{http.StatusFound, nil, "3xx"},
+		{http.StatusTooManyRequests, nil, "4xx"},
+		{http.StatusBadGateway, nil, "5xx"},
+		{0, errors.New("boom"), "error"},
+	}
+
+	for _, tt := range tests {
+		if got := metrics.StatusClass(tt.status, tt.err); got != tt.want {
+			t.Errorf("StatusClass(%d, %v) = %q, want %q", tt.status, tt.err, got, tt.want)
+		}
+	}
+}
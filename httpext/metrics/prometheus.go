@@ -0,0 +1,108 @@
+package metrics
+
+import (
+	"bufio"
+	"expvar"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// PrometheusContentType is the content type of the Prometheus text exposition format
+const PrometheusContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// metricPrefix is prepended to every metric name in the Prometheus output
+const metricPrefix = "httpext_"
+
+// WritePrometheus writes the metrics of e in the Prometheus text exposition format
+func (e *Expvar) WritePrometheus(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+
+	writeCounters(bw, "requests_total", "counter", "Requests sent by host, method and status class.", e.requests)
+	writeCounters(bw, "errors_total", "counter", "Failed requests by host, method and error kind.", e.errors)
+	writeCounters(bw, "retries_total", "counter", "Retried attempts by host and method.", e.retries)
+	writeCounters(bw, "requests_in_flight", "gauge", "Requests waiting for a response by host and method.", e.inFlight)
+	writeHistograms(bw, "request_duration_seconds", "Time until the response headers arrived by host and method.", e.durations)
+	writeHistograms(bw, "phase_duration_seconds", "Duration of connection phases by host, method and phase.", e.phases)
+
+	return bw.Flush()
+}
+
+// Handler returns an http.Handler serving the metrics of e to Prometheus
+func (e *Expvar) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", PrometheusContentType)
+		e.WritePrometheus(w)
+	})
+}
+
+func writeHeader(w io.Writer, name, typ, help string) {
+	fmt.Fprintf(w, "# HELP %s%s %s\n# TYPE %s%s %s\n", metricPrefix, name, help, metricPrefix, name, typ)
+}
+
+func writeCounters(w io.Writer, name, typ, help string, m *expvar.Map) {
+	writeHeader(w, name, typ, help)
+
+	// expvar.Map iterates in key order, which keeps the output stable
+	m.Do(func(kv expvar.KeyValue) {
+		fmt.Fprintf(w, "%s%s%s %s\n", metricPrefix, name, promLabels(parseLabels(kv.Key)), kv.Value.String())
+	})
+}
+
+func writeHistograms(w io.Writer, name, help string, m *expvar.Map) {
+	writeHeader(w, name, "histogram", help)
+
+	m.Do(func(kv expvar.KeyValue) {
+		h, ok := kv.Value.(*histogram)
+		if !ok {
+			return
+		}
+
+		s := h.snapshot()
+		pairs := parseLabels(kv.Key)
+
+		// Prometheus buckets are cumulative
+		var cumulative uint64
+		for i, bound := range s.Bounds {
+			cumulative += s.Counts[i]
+			le := append(slices.Clone(pairs), [2]string{"le", strconv.FormatFloat(bound, 'g', -1, 64)})
+			fmt.Fprintf(w, "%s%s_bucket%s %d\n", metricPrefix, name, promLabels(le), cumulative)
+		}
+
+		inf := append(slices.Clone(pairs), [2]string{"le", "+Inf"})
+		fmt.Fprintf(w, "%s%s_bucket%s %d\n", metricPrefix, name, promLabels(inf), s.Count)
+		fmt.Fprintf(w, "%s%s_sum%s %s\n", metricPrefix, name, promLabels(pairs), strconv.FormatFloat(s.Sum, 'g', -1, 64))
+		fmt.Fprintf(w, "%s%s_count%s %d\n", metricPrefix, name, promLabels(pairs), s.Count)
+	})
+}
+
+// promLabels formats label pairs as {name="value",...}
+func promLabels(pairs [][2]string) string {
+	if len(pairs) == 0 {
+		return ""
+	}
+
+	var b strings.Builder
+	b.WriteByte('{')
+
+	for i, pair := range pairs {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+
+		b.WriteString(pair[0] + `="` + escapeLabel(pair[1]) + `"`)
+	}
+
+	b.WriteByte('}')
+
+	return b.String()
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func escapeLabel(v string) string {
+	return labelEscaper.Replace(v)
+}
@@ -16,3 +16,33 @@ type Requester[R, E any] interface {
 		retry bool,
 	) (*R, *E, error)
 }
+
+// BodyRequester is a Requester which encodes request bodies
+type BodyRequester[R, E any] interface {
+	Requester[R, E]
+
+	// RequestBody is like Request but encodes body with the codec of the Content-Type in header,
+	// or the default codec which then sets the Content-Type. A nil body sends no body
+	RequestBody(
+		ctx context.Context,
+		method string,
+		url string,
+		header http.Header,
+		body any,
+		retry bool,
+	) (*R, *E, error)
+}
+
+// RequestWithBody calls r.RequestBody with a typed body
+// Generic parameters: B = request body type, R = response type, E = error type
+func RequestWithBody[B, R, E any](
+	ctx context.Context,
+	r BodyRequester[R, E],
+	method string,
+	url string,
+	header http.Header,
+	body B,
+	retry bool,
+) (*R, *E, error) {
+	return r.RequestBody(ctx, method, url, header, body, retry)
+}
@@ -0,0 +1,89 @@
+package auth
+
+import (
+	"net/http"
+)
+
+// Authenticator adds credentials to a request, it's always given
+// a clone of the caller's request which it may modify
+type Authenticator interface {
+	Authenticate(req *http.Request) error
+}
+
+// AuthenticatorFunc is an adapter to allow the use of ordinary functions as an Authenticator
+type AuthenticatorFunc func(req *http.Request) error
+
+// Authenticate calls f(req)
+func (f AuthenticatorFunc) Authenticate(req *http.Request) error {
+	return f(req)
+}
+
+// Basic authenticates with HTTP basic auth
+func Basic(username, password string) Authenticator {
+	return AuthenticatorFunc(func(req *http.Request) error {
+		req.SetBasicAuth(username, password)
+		return nil
+	})
+}
+
+// Bearer authenticates with a static bearer token
+func Bearer(token string) Authenticator {
+	return AuthenticatorFunc(func(req *http.Request) error {
+		req.Header.Set("Authorization", "Bearer "+token)
+		return nil
+	})
+}
+
+// APIKeyHeader sends an API key in the header name, e.g. X-Api-Key
+func APIKeyHeader(name, key string) Authenticator {
+	return AuthenticatorFunc(func(req *http.Request) error {
+		req.Header.Set(name, key)
+		return nil
+	})
+}
+
+// APIKeyQuery sends an API key in the query parameter name
+func APIKeyQuery(name, key string) Authenticator {
+	return AuthenticatorFunc(func(req *http.Request) error {
+		query := req.URL.Query()
+		query.Set(name, key)
+		req.URL.RawQuery = query.Encode()
+		return nil
+	})
+}
+
+// RoundTripper authenticates every request with an Authenticator
+type RoundTripper struct {
+	authenticator Authenticator
+
+	base http.RoundTripper
+}
+
+// NewRoundTripper creates a new authenticating RoundTripper.
+// If base is nil, http.DefaultTransport is used.
+func NewRoundTripper(a Authenticator, base http.RoundTripper) *RoundTripper {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+
+	return &RoundTripper{authenticator: a, base: base}
+}
+
+// Middleware returns a roundtripper.Middleware which wraps its base with an authenticating RoundTripper
+func Middleware(a Authenticator) func(http.RoundTripper) http.RoundTripper {
+	return func(base http.RoundTripper) http.RoundTripper {
+		return NewRoundTripper(a, base)
+	}
+}
+
+func (rt *RoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	// Clone deep copies the headers and the URL, the body is shared
+	clone := req.Clone(req.Context())
+
+	if err := rt.authenticator.Authenticate(clone); err != nil {
+		closeBody(req)
+		return nil, err
+	}
+
+	return rt.base.RoundTrip(clone)
+}
@@ -0,0 +1,100 @@
+package auth_test
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/tanveerprottoy/stdlib-ext/httpext/roundtripper"
+	"github.com/tanveerprottoy/stdlib-ext/httpext/roundtripper/auth"
+)
+
+func TestAuthenticators(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name  string
+		auth  auth.Authenticator
+		check func(req *http.Request) bool
+	}{
+		{"basic", auth.Basic("user", "pass"), func(req *http.Request) bool {
+			u, p, ok := req.BasicAuth()
+			return ok && u == "user" && p == "pass"
+		}},
+		{"bearer", auth.Bearer("abc"), func(req *http.Request) bool {
+			return req.Header.Get("Authorization") == "Bearer abc"
+		}},
+		{"api key header", auth.APIKeyHeader("X-Api-Key", "k"), func(req *http.Request) bool {
+			return req.Header.Get("X-Api-Key") == "k"
+		}},
+		{"api key query", auth.APIKeyQuery("api_key", "k"), func(req *http.Request) bool {
+			return req.URL.Query().Get("api_key") == "k" && req.URL.Query().Get("page") == "1"
+		}},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			var sent *http.Request
+
+			base := roundtripper.Func(func(req *http.Request) (*http.Response, error) {
+				sent = req
+				return &http.Response{StatusCode: http.StatusOK, Body: http.NoBody}, nil
+			})
+
+			req, _ := http.NewRequest(http.MethodGet, "http://example.com/items?page=1", nil)
+
+			if _, err := auth.NewRoundTripper(tc.auth, base).RoundTrip(req); err != nil {
+				t.Fatalf("RoundTrip error: %v", err)
+			}
+
+			if !tc.check(sent) {
+				t.Errorf("credentials missing from %v %v", sent.URL, sent.Header)
+			}
+
+			if req.Header.Get("Authorization") != "" || req.URL.RawQuery != "page=1" {
+				t.Errorf("the caller's request must not be mutated")
+			}
+		})
+	}
+}
+
+func TestHMACSigner(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	clock := func() time.Time { return now }
+
+	signer := auth.NewHMACSigner("key-1", []byte("secret"), clock)
+
+	var verifyErr error
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		verifyErr = signer.Verify(r, time.Minute)
+	}))
+	defer srv.Close()
+
+	client := &http.Client{Transport: auth.NewRoundTripper(signer, nil)}
+
+	resp, err := client.Post(srv.URL+"/orders?b=2&a=1&a=0", "application/json", strings.NewReader(`{"id":1}`))
+	if err != nil {
+		t.Fatalf("Post error: %v", err)
+	}
+	resp.Body.Close()
+
+	if verifyErr != nil {
+		t.Errorf("Verify error: %v", verifyErr)
+	}
+
+	// a tampered request must be rejected
+	req, _ := http.NewRequest(http.MethodPost, "http://example.com/orders", strings.NewReader(`{"id":1}`))
+	if err := signer.Authenticate(req); err != nil {
+		t.Fatalf("Authenticate error: %v", err)
+	}
+
+	req.URL.Path = "/refunds"
+
+	if err := signer.Verify(req, time.Minute); !errors.Is(err, auth.ErrInvalidSignature) {
+		t.Errorf("expected ErrInvalidSignature, got %v", err)
+	}
+}
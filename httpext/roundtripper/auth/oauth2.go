@@ -0,0 +1,341 @@
+// Package auth provides round trippers which authenticate outgoing requests
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Token is an OAuth2 access token
+type Token struct {
+	AccessToken string
+	TokenType   string
+	Expiry      time.Time // zero when the token does not expire
+}
+
+// valid reports whether t can still be used for delta
+func (t *Token) valid(now time.Time, delta time.Duration) bool {
+	if t == nil || t.AccessToken == "" {
+		return false
+	}
+
+	return t.Expiry.IsZero() || now.Add(delta).Before(t.Expiry)
+}
+
+// header returns the Authorization header value of t
+func (t *Token) header() string {
+	typ := t.TokenType
+	if typ == "" || strings.EqualFold(typ, "bearer") {
+		typ = "Bearer"
+	}
+
+	return typ + " " + t.AccessToken
+}
+
+// TokenSource supplies the tokens of an OAuth2RoundTripper
+type TokenSource interface {
+	// Token returns a valid token
+	Token(ctx context.Context) (*Token, error)
+
+	// Refresh discards stale, which was rejected by the server, and returns a new token
+	Refresh(ctx context.Context, stale *Token) (*Token, error)
+}
+
+// TokenError is returned when the token endpoint rejects a request
+type TokenError struct {
+	StatusCode  int
+	Code        string // error code of RFC 6749 section 5.2, e.g. invalid_client
+	Description string
+	Body        []byte
+}
+
+func (e *TokenError) Error() string {
+	if e.Code != "" {
+		return fmt.Sprintf("auth: token request failed with status %d: %s %s", e.StatusCode, e.Code, e.Description)
+	}
+
+	return fmt.Sprintf("auth: token request failed with status %d", e.StatusCode)
+}
+
+// AuthStyle is how the client authenticates to the token endpoint
+type AuthStyle int
+
+const (
+	AuthStyleHeader AuthStyle = iota // HTTP basic auth, recommended by RFC 6749
+	AuthStyleParams                  // client_id and client_secret in the form body
+)
+
+type ClientCredentialsConfig struct {
+	TokenURL       string
+	ClientID       string
+	ClientSecret   string
+	Scopes         []string
+	EndpointParams url.Values    // additional form parameters, e.g. audience
+	AuthStyle      AuthStyle     // how the client credentials are sent
+	ExpiryDelta    time.Duration // tokens are refreshed this long before they expire, 10 seconds by default
+	HTTPClient     *http.Client  // client used for token requests, a client with a 30 seconds timeout by default
+}
+
+// ClientCredentials is a TokenSource for the OAuth2 client credentials grant.
+// It caches the token until shortly before it expires and concurrent callers share a single fetch
+type ClientCredentials struct {
+	cfg ClientCredentialsConfig
+
+	mu       sync.Mutex
+	token    *Token
+	inflight *tokenCall
+}
+
+// tokenCall is an in-flight token request shared by concurrent callers
+type tokenCall struct {
+	done  chan struct{}
+	token *Token
+	err   error
+}
+
+func NewClientCredentials(cfg ClientCredentialsConfig) *ClientCredentials {
+	if cfg.ExpiryDelta <= 0 {
+		cfg.ExpiryDelta = 10 * time.Second
+	}
+
+	if cfg.HTTPClient == nil {
+		cfg.HTTPClient = &http.Client{Timeout: 30 * time.Second}
+	}
+
+	return &ClientCredentials{cfg: cfg}
+}
+
+// Token implements the TokenSource interface
+func (c *ClientCredentials) Token(ctx context.Context) (*Token, error) {
+	c.mu.Lock()
+	if c.token.valid(time.Now(), c.cfg.ExpiryDelta) {
+		token := c.token
+		c.mu.Unlock()
+		return token, nil
+	}
+
+	call := c.fetchLocked()
+	c.mu.Unlock()
+
+	return c.wait(ctx, call)
+}
+
+// Refresh implements the TokenSource interface, stale is only discarded if it's
+// still the cached token so that concurrent 401s cause a single fetch
+func (c *ClientCredentials) Refresh(ctx context.Context, stale *Token) (*Token, error) {
+	c.mu.Lock()
+	if c.token != nil && c.token != stale && c.token.valid(time.Now(), c.cfg.ExpiryDelta) {
+		// someone else already refreshed it
+		token := c.token
+		c.mu.Unlock()
+		return token, nil
+	}
+
+	c.token = nil
+	call := c.fetchLocked()
+	c.mu.Unlock()
+
+	return c.wait(ctx, call)
+}
+
+// fetchLocked starts a token request unless one is in flight, c.mu must be held
+func (c *ClientCredentials) fetchLocked() *tokenCall {
+	if c.inflight != nil {
+		return c.inflight
+	}
+
+	call := &tokenCall{done: make(chan struct{})}
+	c.inflight = call
+
+	go func() {
+		// the fetch is shared, one caller giving up must not cancel it for the others
+		call.token, call.err = c.fetch(context.Background())
+
+		c.mu.Lock()
+		if call.err == nil {
+			c.token = call.token
+		}
+		c.inflight = nil
+		c.mu.Unlock()
+
+		close(call.done)
+	}()
+
+	return call
+}
+
+func (c *ClientCredentials) wait(ctx context.Context, call *tokenCall) (*Token, error) {
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case <-call.done:
+		return call.token, call.err
+	}
+}
+
+// fetch requests a new token from the token endpoint
+func (c *ClientCredentials) fetch(ctx context.Context) (*Token, error) {
+	form := url.Values{}
+	for k, v := range c.cfg.EndpointParams {
+		form[k] = v
+	}
+
+	form.Set("grant_type", "client_credentials")
+
+	if len(c.cfg.Scopes) > 0 {
+		form.Set("scope", strings.Join(c.cfg.Scopes, " "))
+	}
+
+	if c.cfg.AuthStyle == AuthStyleParams {
+		form.Set("client_id", c.cfg.ClientID)
+		form.Set("client_secret", c.cfg.ClientSecret)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.cfg.TokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+
+	if c.cfg.AuthStyle == AuthStyleHeader {
+		req.SetBasicAuth(url.QueryEscape(c.cfg.ClientID), url.QueryEscape(c.cfg.ClientSecret))
+	}
+
+	start := time.Now()
+
+	resp, err := c.cfg.HTTPClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode < http.StatusOK || resp.StatusCode >= http.StatusMultipleChoices {
+		tokenErr := &TokenError{StatusCode: resp.StatusCode, Body: body}
+
+		var e struct {
+			Error            string `json:"error"`
+			ErrorDescription string `json:"error_description"`
+		}
+		if json.Unmarshal(body, &e) == nil {
+			tokenErr.Code = e.Error
+			tokenErr.Description = e.ErrorDescription
+		}
+
+		return nil, tokenErr
+	}
+
+	var r struct {
+		AccessToken string      `json:"access_token"`
+		TokenType   string      `json:"token_type"`
+		ExpiresIn   json.Number `json:"expires_in"`
+	}
+	if err := json.Unmarshal(body, &r); err != nil {
+		return nil, fmt.Errorf("auth: decoding token response: %w", err)
+	}
+
+	if r.AccessToken == "" {
+		return nil, fmt.Errorf("auth: token response has no access_token")
+	}
+
+	token := &Token{AccessToken: r.AccessToken, TokenType: r.TokenType}
+
+	// expires_in is relative to when the request was sent
+	if secs, err := r.ExpiresIn.Int64(); err == nil && secs > 0 {
+		token.Expiry = start.Add(time.Duration(secs) * time.Second)
+	}
+
+	return token, nil
+}
+
+// OAuth2RoundTripper sets the Authorization header from a TokenSource. When the server
+// answers 401 the token is refreshed and the request is retried once, provided its body can be replayed
+type OAuth2RoundTripper struct {
+	source TokenSource
+
+	base http.RoundTripper
+}
+
+// NewOAuth2RoundTripper creates a new OAuth2RoundTripper.
+// If base is nil, http.DefaultTransport is used.
+func NewOAuth2RoundTripper(source TokenSource, base http.RoundTripper) *OAuth2RoundTripper {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+
+	return &OAuth2RoundTripper{source: source, base: base}
+}
+
+// OAuth2Middleware returns a roundtripper.Middleware which wraps its base with an OAuth2RoundTripper
+func OAuth2Middleware(source TokenSource) func(http.RoundTripper) http.RoundTripper {
+	return func(base http.RoundTripper) http.RoundTripper {
+		return NewOAuth2RoundTripper(source, base)
+	}
+}
+
+func (rt *OAuth2RoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	token, err := rt.source.Token(req.Context())
+	if err != nil {
+		closeBody(req)
+		return nil, err
+	}
+
+	// the body can be replayed for the retry after a 401
+	replayable := req.Body == nil || req.Body == http.NoBody || req.GetBody != nil
+
+	resp, err := rt.base.RoundTrip(withAuthorization(req, token.header()))
+	if err != nil || resp.StatusCode != http.StatusUnauthorized || !replayable {
+		return resp, err
+	}
+
+	token, err = rt.source.Refresh(req.Context(), token)
+	if err != nil {
+		// keep the 401 so that the caller sees what the server said
+		return resp, nil
+	}
+
+	retryReq := withAuthorization(req, token.header())
+	if req.GetBody != nil {
+		body, err := req.GetBody()
+		if err != nil {
+			return resp, nil
+		}
+
+		retryReq.Body = body
+	}
+
+	// drain the response body to reuse the connection
+	io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+
+	return rt.base.RoundTrip(retryReq)
+}
+
+// withAuthorization returns a clone of req with the Authorization header set
+func withAuthorization(req *http.Request, value string) *http.Request {
+	clone := req.Clone(req.Context())
+	clone.Header.Set("Authorization", value)
+
+	return clone
+}
+
+// closeBody closes the request body, a RoundTripper must close it even on errors
+func closeBody(req *http.Request) {
+	if req.Body != nil {
+		req.Body.Close()
+	}
+}
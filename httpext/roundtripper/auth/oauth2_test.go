@@ -0,0 +1,127 @@
+package auth_test
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/tanveerprottoy/stdlib-ext/httpext/roundtripper/auth"
+)
+
+func newTokenServer(t *testing.T, fetches *atomic.Int32) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id, secret, ok := r.BasicAuth()
+		if !ok || id != "client" || secret != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			fmt.Fprint(w, `{"error":"invalid_client"}`)
+			return
+		}
+
+		if r.FormValue("grant_type") != "client_credentials" || r.FormValue("scope") != "read write" {
+			t.Errorf("unexpected token request form %v", r.Form)
+		}
+
+		n := fetches.Add(1)
+
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"access_token":"token-%d","token_type":"bearer","expires_in":3600}`, n)
+	}))
+}
+
+func TestClientCredentials(t *testing.T) {
+	var fetches atomic.Int32
+
+	tokenSrv := newTokenServer(t, &fetches)
+	defer tokenSrv.Close()
+
+	source := auth.NewClientCredentials(auth.ClientCredentialsConfig{
+		TokenURL:     tokenSrv.URL,
+		ClientID:     "client",
+		ClientSecret: "secret",
+		Scopes:       []string{"read", "write"},
+	})
+
+	// subtest testSingleFlight
+	t.Run("testSingleFlight", func(t *testing.T) {
+		var wg sync.WaitGroup
+
+		for i := 0; i < 20; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+
+				if _, err := source.Token(context.Background()); err != nil {
+					t.Errorf("Token error: %v", err)
+				}
+			}()
+		}
+
+		wg.Wait()
+
+		if _, err := source.Token(context.Background()); err != nil {
+			t.Fatalf("Token error: %v", err)
+		}
+
+		if fetches.Load() != 1 {
+			t.Errorf("expected a single cached fetch, got %d", fetches.Load())
+		}
+	})
+
+	// subtest testInvalidClient
+	t.Run("testInvalidClient", func(t *testing.T) {
+		bad := auth.NewClientCredentials(auth.ClientCredentialsConfig{TokenURL: tokenSrv.URL, ClientID: "client", ClientSecret: "wrong"})
+
+		_, err := bad.Token(context.Background())
+
+		tokenErr, ok := err.(*auth.TokenError)
+		if !ok || tokenErr.StatusCode != http.StatusUnauthorized || tokenErr.Code != "invalid_client" {
+			t.Errorf("expected invalid_client TokenError, got %v", err)
+		}
+	})
+}
+
+func TestOAuth2RoundTripper(t *testing.T) {
+	var fetches atomic.Int32
+
+	tokenSrv := newTokenServer(t, &fetches)
+	defer tokenSrv.Close()
+
+	// the api only accepts the second token, as if the first one had been revoked
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer token-2" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		fmt.Fprint(w, r.ContentLength)
+	}))
+	defer api.Close()
+
+	source := auth.NewClientCredentials(auth.ClientCredentialsConfig{
+		TokenURL:     tokenSrv.URL,
+		ClientID:     "client",
+		ClientSecret: "secret",
+		Scopes:       []string{"read", "write"},
+	})
+
+	client := &http.Client{Transport: auth.NewOAuth2RoundTripper(source, nil)}
+
+	resp, err := client.Post(api.URL, "text/plain", strings.NewReader("payload"))
+	if err != nil {
+		t.Fatalf("Post error: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("expected the retry after refresh to succeed, got %d", resp.StatusCode)
+	}
+
+	if fetches.Load() != 2 {
+		t.Errorf("expected 2 token fetches, got %d", fetches.Load())
+	}
+}
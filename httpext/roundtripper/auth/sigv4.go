@@ -0,0 +1,256 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// SigV4Algorithm is the signing algorithm of AWS Signature Version 4
+	SigV4Algorithm = "AWS4-HMAC-SHA256"
+
+	// UnsignedPayload is sent as the payload hash when the body is not signed
+	UnsignedPayload = "UNSIGNED-PAYLOAD"
+
+	sigV4TimeFormat = "20060102T150405Z"
+	sigV4DateFormat = "20060102"
+)
+
+// sigV4IgnoredHeaders are never signed since proxies and transports may change them
+var sigV4IgnoredHeaders = []string{"authorization", "user-agent", "x-amzn-trace-id", "expect"}
+
+type SigV4Config struct {
+	AccessKeyID     string
+	SecretAccessKey string
+	SessionToken    string // set for temporary credentials, sent as X-Amz-Security-Token
+	Region          string
+	Service         string
+
+	UnsignedPayload            bool             // sign UNSIGNED-PAYLOAD instead of the body hash, e.g. for S3 streaming uploads
+	DisableContentSHA256Header bool             // don't send X-Amz-Content-Sha256, only S3 requires it
+	DisableURIPathEscaping     bool             // don't escape the path a second time, S3 expects this
+	Now                        func() time.Time // time.Now by default
+}
+
+// SigV4Signer signs requests with AWS Signature Version 4, it implements
+// the Authenticator interface so it can be used with NewRoundTripper
+type SigV4Signer struct {
+	cfg SigV4Config
+}
+
+func NewSigV4Signer(cfg SigV4Config) *SigV4Signer {
+	if cfg.Now == nil {
+		cfg.Now = time.Now
+	}
+
+	return &SigV4Signer{cfg: cfg}
+}
+
+// Authenticate implements the Authenticator interface
+func (s *SigV4Signer) Authenticate(req *http.Request) error {
+	return s.Sign(req, s.cfg.Now())
+}
+
+// Sign adds the Authorization, X-Amz-Date and, unless disabled, X-Amz-Content-Sha256 headers to req
+func (s *SigV4Signer) Sign(req *http.Request, t time.Time) error {
+	t = t.UTC()
+
+	payloadHash, err := s.payloadHash(req)
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("X-Amz-Date", t.Format(sigV4TimeFormat))
+
+	if !s.cfg.DisableContentSHA256Header {
+		req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+	}
+
+	if s.cfg.SessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", s.cfg.SessionToken)
+	}
+
+	canonicalHeaders, signedHeaders := s.canonicalHeaders(req)
+	canonical := s.canonicalRequest(req, req.URL.Query(), canonicalHeaders, signedHeaders, payloadHash)
+	signature := s.signature(t, canonical)
+
+	req.Header.Set("Authorization", fmt.Sprintf(
+		"%s Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		SigV4Algorithm, s.cfg.AccessKeyID, s.scope(t), signedHeaders, signature,
+	))
+
+	return nil
+}
+
+// Presign returns a URL for req which is valid for expires without any further headers.
+// The headers of req other than Host are signed as well, the caller must send them too
+func (s *SigV4Signer) Presign(req *http.Request, t time.Time, expires time.Duration) (string, error) {
+	if expires <= 0 || expires > 7*24*time.Hour {
+		return "", errors.New("auth: presigned URLs must expire within 7 days")
+	}
+
+	t = t.UTC()
+
+	payloadHash, err := s.payloadHash(req)
+	if err != nil {
+		return "", err
+	}
+
+	canonicalHeaders, signedHeaders := s.canonicalHeaders(req)
+
+	query := req.URL.Query()
+	query.Set("X-Amz-Algorithm", SigV4Algorithm)
+	query.Set("X-Amz-Credential", s.cfg.AccessKeyID+"/"+s.scope(t))
+	query.Set("X-Amz-Date", t.Format(sigV4TimeFormat))
+	query.Set("X-Amz-Expires", strconv.FormatInt(int64(expires/time.Second), 10))
+	query.Set("X-Amz-SignedHeaders", signedHeaders)
+
+	if s.cfg.SessionToken != "" {
+		query.Set("X-Amz-Security-Token", s.cfg.SessionToken)
+	}
+
+	canonical := s.canonicalRequest(req, query, canonicalHeaders, signedHeaders, payloadHash)
+
+	u := *req.URL
+	u.RawQuery = canonicalQuery(query) + "&X-Amz-Signature=" + s.signature(t, canonical)
+
+	return u.String(), nil
+}
+
+func (s *SigV4Signer) payloadHash(req *http.Request) (string, error) {
+	if s.cfg.UnsignedPayload {
+		return UnsignedPayload, nil
+	}
+
+	return hashBody(req)
+}
+
+// canonicalRequest builds
+//
+//	METHOD\nCANONICAL_URI\nCANONICAL_QUERY\nCANONICAL_HEADERS\nSIGNED_HEADERS\nPAYLOAD_HASH
+func (s *SigV4Signer) canonicalRequest(req *http.Request, query url.Values, canonicalHeaders, signedHeaders, payloadHash string) string {
+	return strings.Join([]string{
+		req.Method,
+		s.canonicalURI(req.URL),
+		canonicalQuery(query),
+		canonicalHeaders,
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+}
+
+// canonicalURI escapes every path segment, a second time for services other than S3
+func (s *SigV4Signer) canonicalURI(u *url.URL) string {
+	path := u.EscapedPath()
+	if path == "" {
+		return "/"
+	}
+
+	if s.cfg.DisableURIPathEscaping {
+		return path
+	}
+
+	segments := strings.Split(path, "/")
+	for i, segment := range segments {
+		segments[i] = escape(segment)
+	}
+
+	return strings.Join(segments, "/")
+}
+
+// canonicalHeaders returns the lowercase, sorted headers with trimmed values and the
+// semicolon separated list of their names
+func (s *SigV4Signer) canonicalHeaders(req *http.Request) (string, string) {
+	values := map[string]string{"host": canonicalHost(req)}
+
+	for name, vs := range req.Header {
+		name = strings.ToLower(name)
+		if name == "host" || slices.Contains(sigV4IgnoredHeaders, name) {
+			continue
+		}
+
+		trimmed := make([]string, len(vs))
+		for i, v := range vs {
+			// collapse sequential spaces
+			trimmed[i] = strings.Join(strings.Fields(v), " ")
+		}
+
+		values[name] = strings.Join(trimmed, ",")
+	}
+
+	names := make([]string, 0, len(values))
+	for name := range values {
+		names = append(names, name)
+	}
+
+	slices.Sort(names)
+
+	var b strings.Builder
+	for _, name := range names {
+		b.WriteString(name + ":" + values[name] + "\n")
+	}
+
+	return b.String(), strings.Join(names, ";")
+}
+
+// canonicalHost returns the request host without the default port of its scheme
+func canonicalHost(req *http.Request) string {
+	host := req.Host
+	if host == "" {
+		host = req.URL.Host
+	}
+
+	if h, port, err := net.SplitHostPort(host); err == nil {
+		if (port == "80" && req.URL.Scheme == "http") || (port == "443" && req.URL.Scheme == "https") {
+			return h
+		}
+	}
+
+	return host
+}
+
+func (s *SigV4Signer) scope(t time.Time) string {
+	return strings.Join([]string{t.Format(sigV4DateFormat), s.cfg.Region, s.cfg.Service, "aws4_request"}, "/")
+}
+
+// signature signs the string to sign built from the canonical request
+func (s *SigV4Signer) signature(t time.Time, canonical string) string {
+	hash := sha256.Sum256([]byte(canonical))
+
+	stringToSign := strings.Join([]string{
+		SigV4Algorithm,
+		t.Format(sigV4TimeFormat),
+		s.scope(t),
+		hex.EncodeToString(hash[:]),
+	}, "\n")
+
+	key := SigV4SigningKey(s.cfg.SecretAccessKey, t, s.cfg.Region, s.cfg.Service)
+
+	return hex.EncodeToString(hmacSHA256(key, stringToSign))
+}
+
+// SigV4SigningKey derives the signing key for a day, region and service
+func SigV4SigningKey(secret string, t time.Time, region, service string) []byte {
+	kDate := hmacSHA256([]byte("AWS4"+secret), t.UTC().Format(sigV4DateFormat))
+	kRegion := hmacSHA256(kDate, region)
+	kService := hmacSHA256(kRegion, service)
+
+	return hmacSHA256(kService, "aws4_request")
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+
+	return mac.Sum(nil)
+}
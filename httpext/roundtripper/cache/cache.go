@@ -0,0 +1,163 @@
+package cache
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// Cache stores the serialized responses of a RoundTripper, implementations must be safe for concurrent use
+type Cache interface {
+	Get(key string) ([]byte, bool)
+	Set(key string, value []byte)
+	Delete(key string)
+}
+
+// MemoryCache is an in-memory Cache which evicts the least recently used entries
+// once the total size of the stored values exceeds its limit
+type MemoryCache struct {
+	maxBytes int64
+
+	mu      sync.Mutex
+	size    int64
+	order   *list.List // front is the most recently used
+	entries map[string]*list.Element
+}
+
+type memoryEntry struct {
+	key   string
+	value []byte
+}
+
+// NewMemoryCache creates a new MemoryCache holding up to maxBytes of values, <= 0 means no limit
+func NewMemoryCache(maxBytes int64) *MemoryCache {
+	return &MemoryCache{
+		maxBytes: maxBytes,
+		order:    list.New(),
+		entries:  make(map[string]*list.Element),
+	}
+}
+
+func (c *MemoryCache) Get(key string) ([]byte, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	el, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+
+	c.order.MoveToFront(el)
+
+	return el.Value.(*memoryEntry).value, true
+}
+
+func (c *MemoryCache) Set(key string, value []byte) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.maxBytes > 0 && int64(len(value)) > c.maxBytes {
+		// it would evict everything else and still not fit
+		c.deleteLocked(key)
+		return
+	}
+
+	if el, ok := c.entries[key]; ok {
+		e := el.Value.(*memoryEntry)
+		c.size += int64(len(value) - len(e.value))
+		e.value = value
+		c.order.MoveToFront(el)
+	} else {
+		c.entries[key] = c.order.PushFront(&memoryEntry{key: key, value: value})
+		c.size += int64(len(value))
+	}
+
+	for c.maxBytes > 0 && c.size > c.maxBytes {
+		c.deleteLocked(c.order.Back().Value.(*memoryEntry).key)
+	}
+}
+
+func (c *MemoryCache) Delete(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.deleteLocked(key)
+}
+
+// Len returns the number of stored entries
+func (c *MemoryCache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return len(c.entries)
+}
+
+func (c *MemoryCache) deleteLocked(key string) {
+	el, ok := c.entries[key]
+	if !ok {
+		return
+	}
+
+	c.order.Remove(el)
+	delete(c.entries, key)
+	c.size -= int64(len(el.Value.(*memoryEntry).value))
+}
+
+// DiskCache is a Cache which stores every entry in its own file below a directory,
+// so that cached responses survive restarts. It doesn't evict entries
+type DiskCache struct {
+	dir string
+}
+
+// NewDiskCache creates a new DiskCache in dir, creating the directory if needed
+func NewDiskCache(dir string) (*DiskCache, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, err
+	}
+
+	return &DiskCache{dir: dir}, nil
+}
+
+// path maps key to a file name, keys are hashed since URLs aren't valid file names
+func (c *DiskCache) path(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return filepath.Join(c.dir, hex.EncodeToString(sum[:]))
+}
+
+func (c *DiskCache) Get(key string) ([]byte, bool) {
+	b, err := os.ReadFile(c.path(key))
+	if err != nil {
+		return nil, false
+	}
+
+	return b, true
+}
+
+func (c *DiskCache) Set(key string, value []byte) {
+	// write to a temporary file and rename it so that readers never see a partial entry
+	f, err := os.CreateTemp(c.dir, "tmp-")
+	if err != nil {
+		return
+	}
+
+	_, err = f.Write(value)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+
+	if err != nil {
+		os.Remove(f.Name())
+		return
+	}
+
+	if err := os.Rename(f.Name(), c.path(key)); err != nil {
+		os.Remove(f.Name())
+	}
+}
+
+func (c *DiskCache) Delete(key string) {
+	os.Remove(c.path(key))
+}
@@ -0,0 +1,534 @@
+// Package cache provides a private HTTP cache round tripper with pluggable storage
+package cache
+
+import (
+	"bytes"
+	"context"
+	"encoding/gob"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/tanveerprottoy/stdlib-ext/httpext/backoff"
+)
+
+// StatusHeader reports how a response was served: HIT, MISS, STALE or REVALIDATED
+const StatusHeader = "X-Cache"
+
+const (
+	StatusHit         = "HIT"
+	StatusMiss        = "MISS"
+	StatusStale       = "STALE"
+	StatusRevalidated = "REVALIDATED"
+)
+
+// DefaultMaxEntrySize is the largest response body which is stored
+const DefaultMaxEntrySize = 10 << 20 // 10 MiB
+
+// cacheableStatus are the status codes which are heuristically cacheable, RFC 9110 section 15.1
+var cacheableStatus = []int{
+	http.StatusOK,
+	http.StatusNonAuthoritativeInfo,
+	http.StatusNoContent,
+	http.StatusMultipleChoices,
+	http.StatusMovedPermanently,
+	http.StatusPermanentRedirect,
+	http.StatusNotFound,
+	http.StatusMethodNotAllowed,
+	http.StatusGone,
+	http.StatusRequestURITooLong,
+	http.StatusNotImplemented,
+}
+
+// hopByHopHeaders are not taken from a 304 response when updating a stored one
+var hopByHopHeaders = []string{"Connection", "Keep-Alive", "Proxy-Connection", "Transfer-Encoding", "Upgrade", "Content-Length"}
+
+type Option func(*RoundTripper)
+
+// WithMaxEntrySize sets the largest response body which is stored
+func WithMaxEntrySize(n int64) Option {
+	return func(rt *RoundTripper) {
+		rt.maxEntrySize = n
+	}
+}
+
+// WithClock sets the clock used for freshness calculations
+func WithClock(c backoff.Clock) Option {
+	return func(rt *RoundTripper) {
+		rt.clock = c
+	}
+}
+
+// RoundTripper is a private HTTP cache for GET and HEAD requests following RFC 9111.
+// It honors max-age, Expires, no-store, no-cache, Vary and stale-while-revalidate
+// and revalidates stale responses with If-None-Match/If-Modified-Since.
+// Responses to requests with an Authorization header are only stored when they are public,
+// so that a client shared by several credentials doesn't serve them to each other
+type RoundTripper struct {
+	cache        Cache
+	maxEntrySize int64
+	clock        backoff.Clock
+
+	mu           sync.Mutex
+	revalidating map[string]bool // keys with a background revalidation in flight
+
+	base http.RoundTripper
+}
+
+// NewRoundTripper creates a new caching RoundTripper storing responses in c.
+// If base is nil, http.DefaultTransport is used.
+func NewRoundTripper(c Cache, base http.RoundTripper, opts ...Option) *RoundTripper {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+
+	rt := &RoundTripper{
+		cache:        c,
+		maxEntrySize: DefaultMaxEntrySize,
+		clock:        backoff.SystemClock(),
+		revalidating: make(map[string]bool),
+		base:         base,
+	}
+
+	for _, opt := range opts {
+		opt(rt)
+	}
+
+	return rt
+}
+
+// Middleware returns a roundtripper.Middleware which wraps its base with a caching RoundTripper
+func Middleware(c Cache, opts ...Option) func(http.RoundTripper) http.RoundTripper {
+	return func(base http.RoundTripper) http.RoundTripper {
+		return NewRoundTripper(c, base, opts...)
+	}
+}
+
+// entry is a stored response
+type entry struct {
+	RequestTime  time.Time
+	ResponseTime time.Time
+	Vary         http.Header // the request headers named by the Vary header
+	StatusCode   int
+	Header       http.Header
+	Body         []byte
+}
+
+func key(req *http.Request) string {
+	return req.Method + " " + req.URL.String()
+}
+
+func (rt *RoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Method != http.MethodGet && req.Method != http.MethodHead {
+		resp, err := rt.base.RoundTrip(req)
+		if err == nil && resp.StatusCode < http.StatusBadRequest && isUnsafe(req.Method) {
+			// a successful unsafe request invalidates the stored responses, RFC 9111 section 4.4
+			rt.cache.Delete(http.MethodGet + " " + req.URL.String())
+			rt.cache.Delete(http.MethodHead + " " + req.URL.String())
+		}
+
+		return resp, err
+	}
+
+	reqCC := parseCacheControl(req.Header)
+	if _, ok := reqCC["no-store"]; ok {
+		return rt.base.RoundTrip(req)
+	}
+
+	e := rt.load(req)
+
+	if e == nil {
+		if _, ok := reqCC["only-if-cached"]; ok {
+			return &http.Response{
+				Status:     "504 Gateway Timeout",
+				StatusCode: http.StatusGatewayTimeout,
+				Proto:      "HTTP/1.1",
+				ProtoMajor: 1,
+				ProtoMinor: 1,
+				Header:     http.Header{StatusHeader: {StatusMiss}},
+				Body:       http.NoBody,
+				Request:    req,
+			}, nil
+		}
+
+		return rt.fetch(req, StatusMiss)
+	}
+
+	now := rt.clock.Now()
+	respCC := parseCacheControl(e.Header)
+	age := e.age(now)
+	lifetime := e.freshnessLifetime()
+
+	if rt.isFresh(reqCC, respCC, age, lifetime) {
+		return e.response(req, age, StatusHit), nil
+	}
+
+	// serve stale while a background request revalidates, RFC 5861
+	if swr, ok := seconds(respCC, "stale-while-revalidate"); ok && !noCache(reqCC, respCC) && age < lifetime+swr {
+		if rt.startRevalidation(key(req)) {
+			go rt.revalidateInBackground(req.Clone(context.WithoutCancel(req.Context())), e)
+		}
+
+		return e.response(req, age, StatusStale), nil
+	}
+
+	return rt.revalidate(req, e)
+}
+
+// isFresh reports whether a stored response may be served without contacting the server
+func (rt *RoundTripper) isFresh(reqCC, respCC map[string]string, age, lifetime time.Duration) bool {
+	if noCache(reqCC, respCC) {
+		return false
+	}
+
+	if maxAge, ok := seconds(reqCC, "max-age"); ok && age > maxAge {
+		return false
+	}
+
+	return age < lifetime
+}
+
+func noCache(reqCC, respCC map[string]string) bool {
+	_, reqNoCache := reqCC["no-cache"]
+	_, respNoCache := respCC["no-cache"]
+
+	return reqNoCache || respNoCache
+}
+
+// startRevalidation reports whether the caller should revalidate key in the background,
+// only one revalidation per key is in flight
+func (rt *RoundTripper) startRevalidation(key string) bool {
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+
+	if rt.revalidating[key] {
+		return false
+	}
+
+	rt.revalidating[key] = true
+
+	return true
+}
+
+// revalidateInBackground refreshes a stored response, the result is only stored
+func (rt *RoundTripper) revalidateInBackground(req *http.Request, e *entry) {
+	defer func() {
+		rt.mu.Lock()
+		delete(rt.revalidating, key(req))
+		rt.mu.Unlock()
+	}()
+
+	resp, err := rt.revalidate(req, e)
+	if err != nil {
+		return
+	}
+
+	io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+}
+
+// revalidate sends a conditional request for a stored response
+func (rt *RoundTripper) revalidate(req *http.Request, e *entry) (*http.Response, error) {
+	etag := e.Header.Get("ETag")
+	lastModified := e.Header.Get("Last-Modified")
+
+	if etag == "" && lastModified == "" {
+		return rt.fetch(req, StatusMiss)
+	}
+
+	conditional := req.Clone(req.Context())
+	if etag != "" {
+		conditional.Header.Set("If-None-Match", etag)
+	}
+
+	if lastModified != "" {
+		conditional.Header.Set("If-Modified-Since", lastModified)
+	}
+
+	requestTime := rt.clock.Now()
+
+	resp, err := rt.base.RoundTrip(conditional)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode != http.StatusNotModified {
+		return rt.store(req, resp, requestTime, StatusMiss)
+	}
+
+	io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+
+	// the stored response is still valid, take the new metadata, RFC 9111 section 4.3.4
+	for name, values := range resp.Header {
+		if !slices.Contains(hopByHopHeaders, name) {
+			e.Header[name] = values
+		}
+	}
+
+	e.RequestTime = requestTime
+	e.ResponseTime = rt.clock.Now()
+
+	rt.save(req, e)
+
+	return e.response(req, e.age(e.ResponseTime), StatusRevalidated), nil
+}
+
+// fetch sends req and stores the response when allowed
+func (rt *RoundTripper) fetch(req *http.Request, status string) (*http.Response, error) {
+	requestTime := rt.clock.Now()
+
+	resp, err := rt.base.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+
+	return rt.store(req, resp, requestTime, status)
+}
+
+// store saves resp if it's cacheable and returns a response with a replayable body
+func (rt *RoundTripper) store(req *http.Request, resp *http.Response, requestTime time.Time, status string) (*http.Response, error) {
+	resp.Header.Set(StatusHeader, status)
+
+	if !rt.isCacheable(req, resp) {
+		return resp, nil
+	}
+
+	// read one byte past the limit to know whether the body fits
+	body, err := io.ReadAll(io.LimitReader(resp.Body, rt.maxEntrySize+1))
+	if err != nil {
+		resp.Body.Close()
+		return nil, err
+	}
+
+	if int64(len(body)) > rt.maxEntrySize {
+		resp.Body = &readCloser{Reader: io.MultiReader(bytes.NewReader(body), resp.Body), Closer: resp.Body}
+		return resp, nil
+	}
+
+	resp.Body.Close()
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+
+	e := &entry{
+		RequestTime:  requestTime,
+		ResponseTime: rt.clock.Now(),
+		Vary:         http.Header{},
+		StatusCode:   resp.StatusCode,
+		Header:       resp.Header.Clone(),
+		Body:         body,
+	}
+	e.Header.Del(StatusHeader)
+
+	for _, name := range varyHeaders(resp.Header) {
+		e.Vary[name] = req.Header.Values(name)
+	}
+
+	rt.save(req, e)
+
+	return resp, nil
+}
+
+// isCacheable decides whether a response may be stored, RFC 9111 section 3
+func (rt *RoundTripper) isCacheable(req *http.Request, resp *http.Response) bool {
+	if !slices.Contains(cacheableStatus, resp.StatusCode) {
+		return false
+	}
+
+	if _, ok := parseCacheControl(req.Header)["no-store"]; ok {
+		return false
+	}
+
+	respCC := parseCacheControl(resp.Header)
+	if _, ok := respCC["no-store"]; ok {
+		return false
+	}
+
+	// the response may depend on the credentials, RFC 9111 section 3.5
+	if _, ok := respCC["public"]; !ok && req.Header.Get("Authorization") != "" {
+		return false
+	}
+
+	if slices.Contains(varyHeaders(resp.Header), "*") {
+		return false
+	}
+
+	// something must make the response reusable: freshness information or a validator
+	_, hasMaxAge := respCC["max-age"]
+	_, hasNoCache := respCC["no-cache"]
+
+	return hasMaxAge || hasNoCache ||
+		resp.Header.Get("Expires") != "" ||
+		resp.Header.Get("ETag") != "" ||
+		resp.Header.Get("Last-Modified") != ""
+}
+
+// load returns the stored response matching req including its Vary headers
+func (rt *RoundTripper) load(req *http.Request) *entry {
+	b, ok := rt.cache.Get(key(req))
+	if !ok {
+		return nil
+	}
+
+	var e entry
+	if err := gob.NewDecoder(bytes.NewReader(b)).Decode(&e); err != nil {
+		rt.cache.Delete(key(req))
+		return nil
+	}
+
+	for name, values := range e.Vary {
+		if !slices.Equal(values, req.Header.Values(name)) {
+			return nil
+		}
+	}
+
+	return &e
+}
+
+func (rt *RoundTripper) save(req *http.Request, e *entry) {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(e); err != nil {
+		return
+	}
+
+	rt.cache.Set(key(req), buf.Bytes())
+}
+
+// age is the current age of a stored response, RFC 9111 section 4.2.3
+func (e *entry) age(now time.Time) time.Duration {
+	var apparentAge time.Duration
+	if date, err := http.ParseTime(e.Header.Get("Date")); err == nil {
+		apparentAge = max(0, e.ResponseTime.Sub(date))
+	}
+
+	responseDelay := e.ResponseTime.Sub(e.RequestTime)
+
+	correctedAge := responseDelay
+	if ageValue, err := strconv.ParseInt(e.Header.Get("Age"), 10, 64); err == nil {
+		correctedAge += time.Duration(ageValue) * time.Second
+	}
+
+	return max(apparentAge, correctedAge) + now.Sub(e.ResponseTime)
+}
+
+// freshnessLifetime is how long a response is fresh, RFC 9111 section 4.2.1
+func (e *entry) freshnessLifetime() time.Duration {
+	cc := parseCacheControl(e.Header)
+
+	if maxAge, ok := seconds(cc, "max-age"); ok {
+		return maxAge
+	}
+
+	date, dateErr := http.ParseTime(e.Header.Get("Date"))
+	if dateErr != nil {
+		date = e.ResponseTime
+	}
+
+	if expires := e.Header.Get("Expires"); expires != "" {
+		t, err := http.ParseTime(expires)
+		if err != nil {
+			// invalid dates mean already expired
+			return 0
+		}
+
+		return max(0, t.Sub(date))
+	}
+
+	// heuristic freshness of 10% of the time since the last modification
+	if lastModified, err := http.ParseTime(e.Header.Get("Last-Modified")); err == nil && date.After(lastModified) {
+		return date.Sub(lastModified) / 10
+	}
+
+	return 0
+}
+
+// response builds a response from a stored entry
+func (e *entry) response(req *http.Request, age time.Duration, status string) *http.Response {
+	header := e.Header.Clone()
+	header.Set("Age", strconv.FormatInt(int64(age/time.Second), 10))
+	header.Set(StatusHeader, status)
+
+	resp := &http.Response{
+		Status:        fmt.Sprintf("%d %s", e.StatusCode, http.StatusText(e.StatusCode)),
+		StatusCode:    e.StatusCode,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          io.NopCloser(bytes.NewReader(e.Body)),
+		ContentLength: int64(len(e.Body)),
+		Request:       req,
+	}
+
+	if req.Method == http.MethodHead {
+		resp.Body = http.NoBody
+	}
+
+	return resp
+}
+
+func isUnsafe(method string) bool {
+	switch method {
+	case http.MethodPost, http.MethodPut, http.MethodDelete, http.MethodPatch:
+		return true
+	}
+
+	return false
+}
+
+// parseCacheControl parses the Cache-Control directives of h into lowercase names and unquoted values
+func parseCacheControl(h http.Header) map[string]string {
+	cc := map[string]string{}
+
+	for _, value := range h.Values("Cache-Control") {
+		for _, directive := range strings.Split(value, ",") {
+			name, arg, _ := strings.Cut(strings.TrimSpace(directive), "=")
+			if name == "" {
+				continue
+			}
+
+			cc[strings.ToLower(name)] = strings.Trim(arg, `"`)
+		}
+	}
+
+	return cc
+}
+
+// seconds returns the delta-seconds argument of a directive
+func seconds(cc map[string]string, name string) (time.Duration, bool) {
+	v, ok := cc[name]
+	if !ok {
+		return 0, false
+	}
+
+	secs, err := strconv.ParseInt(v, 10, 64)
+	if err != nil || secs < 0 {
+		return 0, false
+	}
+
+	return time.Duration(secs) * time.Second, true
+}
+
+// varyHeaders returns the canonical header names listed by Vary
+func varyHeaders(h http.Header) []string {
+	var names []string
+
+	for _, value := range h.Values("Vary") {
+		for _, name := range strings.Split(value, ",") {
+			if name = strings.TrimSpace(name); name != "" {
+				names = append(names, http.CanonicalHeaderKey(name))
+			}
+		}
+	}
+
+	return names
+}
+
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
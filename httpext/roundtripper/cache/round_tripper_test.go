@@ -0,0 +1,316 @@
+package cache_test
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/tanveerprottoy/stdlib-ext/httpext/internal/backofftest"
+	"github.com/tanveerprottoy/stdlib-ext/httpext/roundtripper/cache"
+)
+
+func get(t *testing.T, rt http.RoundTripper, url string, header http.Header) (*http.Response, string) {
+	t.Helper()
+
+	req, _ := http.NewRequest(http.MethodGet, url, nil)
+	for name, values := range header {
+		req.Header[name] = values
+	}
+
+	resp, err := rt.RoundTrip(req)
+	if err != nil {
+		t.Fatalf("RoundTrip error: %v", err)
+	}
+	defer resp.Body.Close()
+
+	body, _ := io.ReadAll(resp.Body)
+
+	return resp, string(body)
+}
+
+func TestRoundTripper(t *testing.T) {
+	var calls atomic.Int32
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/max-age", func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.Header().Set("Cache-Control", "max-age=60")
+		w.Write([]byte("fresh"))
+	})
+	mux.HandleFunc("/no-store", func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.Header().Set("Cache-Control", "no-store, max-age=60")
+		w.Write([]byte("secret"))
+	})
+	mux.HandleFunc("/etag", func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.Header().Set("Cache-Control", "no-cache")
+		w.Header().Set("ETag", `"v1"`)
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Write([]byte("validated"))
+	})
+	mux.HandleFunc("/vary", func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.Header().Set("Cache-Control", "max-age=60")
+		w.Header().Set("Vary", "Accept-Language")
+		w.Write([]byte(r.Header.Get("Accept-Language")))
+	})
+	mux.HandleFunc("/swr", func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.Header().Set("Cache-Control", "max-age=10, stale-while-revalidate=60")
+		w.Write([]byte("swr"))
+	})
+
+	release := make(chan struct{})
+	mux.HandleFunc("/swr-slow", func(w http.ResponseWriter, r *http.Request) {
+		// revalidations wait until they are released
+		if calls.Add(1) > 1 {
+			<-release
+		}
+		w.Header().Set("Cache-Control", "max-age=10, stale-while-revalidate=60")
+		w.Write([]byte("swr"))
+	})
+	mux.HandleFunc("/private", func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.Header().Set("Cache-Control", "max-age=60")
+		w.Write([]byte(r.Header.Get("Authorization")))
+	})
+	mux.HandleFunc("/public", func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.Header().Set("Cache-Control", "public, max-age=60")
+		w.Write([]byte("public"))
+	})
+
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	newRoundTripper := func() (*cache.RoundTripper, *backofftest.Clock) {
+		calls.Store(0)
+		clock := backofftest.NewClock(time.Now())
+		return cache.NewRoundTripper(cache.NewMemoryCache(1<<20), nil, cache.WithClock(clock)), clock
+	}
+
+	// subtest testFreshResponseIsServedFromCache
+	t.Run("testFreshResponseIsServedFromCache", func(t *testing.T) {
+		rt, clock := newRoundTripper()
+
+		resp, _ := get(t, rt, srv.URL+"/max-age", nil)
+		if resp.Header.Get(cache.StatusHeader) != cache.StatusMiss {
+			t.Errorf("expected MISS, got %q", resp.Header.Get(cache.StatusHeader))
+		}
+
+		clock.Advance(30 * time.Second)
+
+		resp, body := get(t, rt, srv.URL+"/max-age", nil)
+		if resp.Header.Get(cache.StatusHeader) != cache.StatusHit || body != "fresh" {
+			t.Errorf("expected HIT with body fresh, got %q %q", resp.Header.Get(cache.StatusHeader), body)
+		}
+
+		if calls.Load() != 1 {
+			t.Errorf("expected 1 call, got %d", calls.Load())
+		}
+
+		// expired
+		clock.Advance(time.Minute)
+
+		get(t, rt, srv.URL+"/max-age", nil)
+		if calls.Load() != 2 {
+			t.Errorf("expected 2 calls, got %d", calls.Load())
+		}
+	})
+
+	// subtest testNoStoreIsNotCached
+	t.Run("testNoStoreIsNotCached", func(t *testing.T) {
+		rt, _ := newRoundTripper()
+
+		get(t, rt, srv.URL+"/no-store", nil)
+		get(t, rt, srv.URL+"/no-store", nil)
+
+		if calls.Load() != 2 {
+			t.Errorf("expected 2 calls, got %d", calls.Load())
+		}
+	})
+
+	// subtest testRevalidatesWithETag
+	t.Run("testRevalidatesWithETag", func(t *testing.T) {
+		rt, _ := newRoundTripper()
+
+		get(t, rt, srv.URL+"/etag", nil)
+
+		resp, body := get(t, rt, srv.URL+"/etag", nil)
+		if resp.StatusCode != http.StatusOK || resp.Header.Get(cache.StatusHeader) != cache.StatusRevalidated || body != "validated" {
+			t.Errorf("expected revalidated 200 with the stored body, got %d %q %q", resp.StatusCode, resp.Header.Get(cache.StatusHeader), body)
+		}
+
+		if calls.Load() != 2 {
+			t.Errorf("expected 2 calls, got %d", calls.Load())
+		}
+	})
+
+	// subtest testVary
+	t.Run("testVary", func(t *testing.T) {
+		rt, _ := newRoundTripper()
+
+		get(t, rt, srv.URL+"/vary", http.Header{"Accept-Language": {"en"}})
+
+		_, body := get(t, rt, srv.URL+"/vary", http.Header{"Accept-Language": {"de"}})
+		if body != "de" {
+			t.Errorf("expected body de, got %q", body)
+		}
+
+		_, body = get(t, rt, srv.URL+"/vary", http.Header{"Accept-Language": {"de"}})
+		if body != "de" || calls.Load() != 2 {
+			t.Errorf("expected cached body de after 2 calls, got %q after %d", body, calls.Load())
+		}
+	})
+
+	// subtest testRequestNoCache
+	t.Run("testRequestNoCache", func(t *testing.T) {
+		rt, _ := newRoundTripper()
+
+		get(t, rt, srv.URL+"/max-age", nil)
+		get(t, rt, srv.URL+"/max-age", http.Header{"Cache-Control": {"no-cache"}})
+
+		if calls.Load() != 2 {
+			t.Errorf("expected 2 calls, got %d", calls.Load())
+		}
+	})
+
+	// subtest testUnsafeMethodInvalidates
+	t.Run("testUnsafeMethodInvalidates", func(t *testing.T) {
+		rt, _ := newRoundTripper()
+
+		get(t, rt, srv.URL+"/max-age", nil)
+
+		req, _ := http.NewRequest(http.MethodPost, srv.URL+"/max-age", nil)
+		resp, err := rt.RoundTrip(req)
+		if err != nil {
+			t.Fatalf("RoundTrip error: %v", err)
+		}
+		resp.Body.Close()
+
+		resp, _ = get(t, rt, srv.URL+"/max-age", nil)
+		if resp.Header.Get(cache.StatusHeader) != cache.StatusMiss {
+			t.Errorf("expected MISS after POST, got %q", resp.Header.Get(cache.StatusHeader))
+		}
+	})
+
+	// subtest testStaleWhileRevalidate
+	t.Run("testStaleWhileRevalidate", func(t *testing.T) {
+		rt, clock := newRoundTripper()
+
+		get(t, rt, srv.URL+"/swr", nil)
+
+		clock.Advance(30 * time.Second)
+
+		resp, body := get(t, rt, srv.URL+"/swr", nil)
+		if resp.Header.Get(cache.StatusHeader) != cache.StatusStale || body != "swr" {
+			t.Errorf("expected STALE with body swr, got %q %q", resp.Header.Get(cache.StatusHeader), body)
+		}
+
+		// the revalidation happens in the background
+		deadline := time.Now().Add(5 * time.Second)
+		for calls.Load() != 2 && time.Now().Before(deadline) {
+			time.Sleep(10 * time.Millisecond)
+		}
+
+		if calls.Load() != 2 {
+			t.Errorf("expected a background revalidation, got %d calls", calls.Load())
+		}
+	})
+
+	// subtest testOneRevalidationPerKey
+	t.Run("testOneRevalidationPerKey", func(t *testing.T) {
+		rt, clock := newRoundTripper()
+
+		get(t, rt, srv.URL+"/swr-slow", nil)
+
+		clock.Advance(30 * time.Second)
+
+		for i := 0; i < 5; i++ {
+			if resp, _ := get(t, rt, srv.URL+"/swr-slow", nil); resp.Header.Get(cache.StatusHeader) != cache.StatusStale {
+				t.Fatalf("expected STALE, got %q", resp.Header.Get(cache.StatusHeader))
+			}
+		}
+
+		// wait for the revalidation to reach the server and give others the time to follow
+		deadline := time.Now().Add(5 * time.Second)
+		for calls.Load() < 2 && time.Now().Before(deadline) {
+			time.Sleep(10 * time.Millisecond)
+		}
+
+		time.Sleep(50 * time.Millisecond)
+		close(release)
+
+		if calls.Load() != 2 {
+			t.Errorf("expected a single background revalidation, got %d calls", calls.Load())
+		}
+	})
+
+	// subtest testAuthorizedResponses
+	t.Run("testAuthorizedResponses", func(t *testing.T) {
+		rt, _ := newRoundTripper()
+
+		get(t, rt, srv.URL+"/private", http.Header{"Authorization": {"Bearer alice"}})
+
+		if _, body := get(t, rt, srv.URL+"/private", http.Header{"Authorization": {"Bearer bob"}}); body != "Bearer bob" {
+			t.Errorf("expected the response of bob's credentials, got %q", body)
+		}
+
+		get(t, rt, srv.URL+"/public", http.Header{"Authorization": {"Bearer alice"}})
+
+		if resp, _ := get(t, rt, srv.URL+"/public", http.Header{"Authorization": {"Bearer bob"}}); resp.Header.Get(cache.StatusHeader) != cache.StatusHit {
+			t.Errorf("expected a public response to be cached, got %q", resp.Header.Get(cache.StatusHeader))
+		}
+
+		if calls.Load() != 3 {
+			t.Errorf("expected 3 calls, got %d", calls.Load())
+		}
+	})
+}
+
+func TestMemoryCache(t *testing.T) {
+	c := cache.NewMemoryCache(10)
+
+	c.Set("a", []byte("aaaa"))
+	c.Set("b", []byte("bbbb"))
+	c.Get("a")
+	c.Set("c", []byte("cccc"))
+
+	if _, ok := c.Get("b"); ok {
+		t.Errorf("expected the least recently used entry b to be evicted")
+	}
+
+	if _, ok := c.Get("a"); !ok {
+		t.Errorf("expected a to be kept")
+	}
+
+	if c.Len() != 2 {
+		t.Errorf("expected 2 entries, got %d", c.Len())
+	}
+}
+
+func TestDiskCache(t *testing.T) {
+	c, err := cache.NewDiskCache(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewDiskCache error: %v", err)
+	}
+
+	c.Set("GET http://example.com/a?b=c", []byte("value"))
+
+	if v, ok := c.Get("GET http://example.com/a?b=c"); !ok || string(v) != "value" {
+		t.Errorf("expected value, got %q %v", v, ok)
+	}
+
+	c.Delete("GET http://example.com/a?b=c")
+
+	if _, ok := c.Get("GET http://example.com/a?b=c"); ok {
+		t.Errorf("expected the entry to be deleted")
+	}
+}
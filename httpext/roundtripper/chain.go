@@ -0,0 +1,32 @@
+// Package roundtripper composes http.RoundTripper middlewares,
+// the implementations live in its sub packages
+package roundtripper
+
+import "net/http"
+
+// Middleware wraps a RoundTripper with additional behaviour
+type Middleware func(http.RoundTripper) http.RoundTripper
+
+// Func is an adapter to allow the use of ordinary functions as a RoundTripper
+type Func func(req *http.Request) (*http.Response, error)
+
+// RoundTrip calls f(req)
+func (f Func) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+// Chain wraps base with the middlewares, the first middleware is the outermost one
+// and sees the request first, e.g. Chain(base, auth, logging, retry) sends every
+// retry attempt through logging. If base is nil, http.DefaultTransport is used.
+func Chain(base http.RoundTripper, middlewares ...Middleware) http.RoundTripper {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+
+	rt := base
+	for i := len(middlewares) - 1; i >= 0; i-- {
+		rt = middlewares[i](rt)
+	}
+
+	return rt
+}
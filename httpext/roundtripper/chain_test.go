@@ -0,0 +1,45 @@
+package roundtripper_test
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/tanveerprottoy/stdlib-ext/httpext/roundtripper"
+)
+
+func TestChain(t *testing.T) {
+	var order []string
+
+	tag := func(name string) roundtripper.Middleware {
+		return func(next http.RoundTripper) http.RoundTripper {
+			return roundtripper.Func(func(req *http.Request) (*http.Response, error) {
+				order = append(order, name)
+				return next.RoundTrip(req)
+			})
+		}
+	}
+
+	base := roundtripper.Func(func(req *http.Request) (*http.Response, error) {
+		order = append(order, "base")
+		return &http.Response{StatusCode: http.StatusOK, Body: http.NoBody}, nil
+	})
+
+	rt := roundtripper.Chain(base, tag("auth"), tag("logging"), tag("retry"))
+
+	req, _ := http.NewRequest(http.MethodGet, "http://example.com", nil)
+	if _, err := rt.RoundTrip(req); err != nil {
+		t.Fatalf("RoundTrip error: %v", err)
+	}
+
+	exp := []string{"auth", "logging", "retry", "base"}
+	if len(order) != len(exp) {
+		t.Fatalf("order = %v; want %v", order, exp)
+	}
+
+	for i := range exp {
+		if order[i] != exp[i] {
+			t.Errorf("order = %v; want %v", order, exp)
+			break
+		}
+	}
+}
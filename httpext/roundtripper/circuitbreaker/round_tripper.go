@@ -0,0 +1,372 @@
+package circuitbreaker
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/tanveerprottoy/stdlib-ext/httpext/backoff"
+)
+
+// ErrOpen is returned without calling the base RoundTripper while the circuit of a key is open
+// or the half-open probe limit is reached
+var ErrOpen = errors.New("circuitbreaker: circuit is open")
+
+// State is the state of a circuit
+type State int
+
+const (
+	StateClosed   State = iota // requests flow, failures are counted
+	StateOpen                  // requests are rejected until the cooldown elapses
+	StateHalfOpen              // a limited number of probes decide whether to close or reopen
+)
+
+func (s State) String() string {
+	switch s {
+	case StateClosed:
+		return "closed"
+	case StateOpen:
+		return "open"
+	case StateHalfOpen:
+		return "half-open"
+	default:
+		return fmt.Sprintf("State(%d)", int(s))
+	}
+}
+
+type Config struct {
+	ConsecutiveFailures int           // trip after this many consecutive failures, 0 disables the condition
+	FailureRatio        float64       // trip when failures/requests reaches this ratio, 0 disables the condition
+	MinRequests         int           // minimum requests in the window before FailureRatio is evaluated
+	Window              time.Duration // interval after which the closed state counts are reset, 0 never resets
+	Cooldown            time.Duration // time spent open before probing
+	HalfOpenProbes      int           // concurrent probes allowed in half-open, as many successes close the circuit
+}
+
+type Option func(*RoundTripper)
+
+// WithKeyFunc sets the function which maps a request to its circuit, the host by default
+func WithKeyFunc(f func(req *http.Request) string) Option {
+	return func(rt *RoundTripper) {
+		rt.keyFunc = f
+	}
+}
+
+// WithFailureFunc sets the function which decides whether an attempt counts as a failure.
+// By default transport errors and 5xx responses are failures. Requests whose context was done
+// are ignored either way
+func WithFailureFunc(f func(req *http.Request, resp *http.Response, err error) bool) Option {
+	return func(rt *RoundTripper) {
+		rt.isFailure = f
+	}
+}
+
+// WithOnStateChange sets a callback invoked after a circuit changes its state
+func WithOnStateChange(f func(key string, from, to State)) Option {
+	return func(rt *RoundTripper) {
+		rt.onStateChange = f
+	}
+}
+
+// WithClock sets the clock used for the window and cooldown
+func WithClock(c backoff.Clock) Option {
+	return func(rt *RoundTripper) {
+		rt.clock = c
+	}
+}
+
+// RoundTripper rejects requests with ErrOpen while the circuit of their key is open,
+// so that retries against a dead dependency don't amplify an outage
+type RoundTripper struct {
+	cfg Config
+
+	keyFunc       func(req *http.Request) string
+	isFailure     func(req *http.Request, resp *http.Response, err error) bool
+	onStateChange func(key string, from, to State)
+	clock         backoff.Clock
+
+	mu       sync.Mutex
+	breakers map[string]*breaker
+
+	base http.RoundTripper
+}
+
+// NewRoundTripper creates a new circuit breaker RoundTripper.
+// If base is nil, http.DefaultTransport is used.
+func NewRoundTripper(cfg Config, base http.RoundTripper, opts ...Option) *RoundTripper {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+
+	// sanitize the config, at least one trip condition is required
+	if cfg.ConsecutiveFailures <= 0 && cfg.FailureRatio <= 0 {
+		cfg.ConsecutiveFailures = 5
+	}
+
+	if cfg.MinRequests <= 0 {
+		cfg.MinRequests = 10
+	}
+
+	if cfg.Cooldown <= 0 {
+		cfg.Cooldown = 30 * time.Second
+	}
+
+	if cfg.HalfOpenProbes <= 0 {
+		cfg.HalfOpenProbes = 1
+	}
+
+	rt := &RoundTripper{
+		cfg:       cfg,
+		keyFunc:   HostKey,
+		isFailure: isFailure,
+		clock:     backoff.SystemClock(),
+		breakers:  make(map[string]*breaker),
+		base:      base,
+	}
+
+	for _, opt := range opts {
+		opt(rt)
+	}
+
+	return rt
+}
+
+// Middleware returns a roundtripper.Middleware which wraps its base with a circuit breaker
+func Middleware(cfg Config, opts ...Option) func(http.RoundTripper) http.RoundTripper {
+	return func(base http.RoundTripper) http.RoundTripper {
+		return NewRoundTripper(cfg, base, opts...)
+	}
+}
+
+// HostKey keys circuits by the request host
+func HostKey(req *http.Request) string {
+	return req.URL.Host
+}
+
+func isFailure(req *http.Request, resp *http.Response, err error) bool {
+	if err != nil {
+		return true
+	}
+
+	return resp.StatusCode >= http.StatusInternalServerError
+}
+
+// State returns the current state of the circuit for key
+func (rt *RoundTripper) State(key string) State {
+	b := rt.breaker(key)
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	// an expired cooldown is reported as half-open
+	if b.state == StateOpen && rt.clock.Now().Sub(b.openedAt) >= rt.cfg.Cooldown {
+		return StateHalfOpen
+	}
+
+	return b.state
+}
+
+func (rt *RoundTripper) breaker(key string) *breaker {
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+
+	b, ok := rt.breakers[key]
+	if !ok {
+		b = &breaker{windowStart: rt.clock.Now()}
+		rt.breakers[key] = b
+	}
+
+	return b
+}
+
+func (rt *RoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	key := rt.keyFunc(req)
+	b := rt.breaker(key)
+
+	generation, transition, err := b.allow(rt.cfg, rt.clock.Now())
+	rt.notify(key, transition)
+
+	if err != nil {
+		if req.Body != nil {
+			req.Body.Close()
+		}
+
+		return nil, fmt.Errorf("%w: %s", err, key)
+	}
+
+	resp, err := rt.base.RoundTrip(req)
+
+	transition = b.record(rt.cfg, rt.clock.Now(), generation, rt.outcome(req, resp, err))
+	rt.notify(key, transition)
+
+	return resp, err
+}
+
+// outcome classifies the result of a request for its circuit
+func (rt *RoundTripper) outcome(req *http.Request, resp *http.Response, err error) outcome {
+	if req.Context().Err() != nil {
+		// the caller gave up, it says nothing about the dependency
+		return outcomeIgnored
+	}
+
+	if rt.isFailure(req, resp, err) {
+		return outcomeFailure
+	}
+
+	return outcomeSuccess
+}
+
+func (rt *RoundTripper) notify(key string, t *transition) {
+	if t != nil && rt.onStateChange != nil {
+		rt.onStateChange(key, t.from, t.to)
+	}
+}
+
+// outcome is the result of a request as seen by its circuit
+type outcome int
+
+const (
+	outcomeSuccess outcome = iota
+	outcomeFailure
+	outcomeIgnored // neither success nor failure, only the half-open probe slot is released
+)
+
+type transition struct {
+	from, to State
+}
+
+// breaker is the circuit of a single key
+type breaker struct {
+	mu sync.Mutex
+
+	state      State
+	generation uint64 // incremented on every state change, stale results are ignored
+
+	// closed state counts
+	windowStart         time.Time
+	requests            int
+	failures            int
+	consecutiveFailures int
+
+	// open state
+	openedAt time.Time
+
+	// half-open state
+	probes    int
+	successes int
+}
+
+// allow reports whether a request may proceed, returning the generation it belongs to
+func (b *breaker) allow(cfg Config, now time.Time) (uint64, *transition, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	var t *transition
+
+	switch b.state {
+	case StateClosed:
+		if cfg.Window > 0 && now.Sub(b.windowStart) >= cfg.Window {
+			b.resetCounts(now)
+		}
+
+		return b.generation, nil, nil
+	case StateOpen:
+		if now.Sub(b.openedAt) < cfg.Cooldown {
+			return b.generation, nil, ErrOpen
+		}
+
+		t = b.setState(StateHalfOpen, now)
+	}
+
+	// half-open
+	if b.probes >= cfg.HalfOpenProbes {
+		return b.generation, t, ErrOpen
+	}
+
+	b.probes++
+
+	return b.generation, t, nil
+}
+
+// record accounts the outcome of a request allowed in generation
+func (b *breaker) record(cfg Config, now time.Time, generation uint64, result outcome) *transition {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if generation != b.generation {
+		return nil
+	}
+
+	if result == outcomeIgnored {
+		// a cancelled probe lets another request probe
+		if b.state == StateHalfOpen {
+			b.probes--
+		}
+
+		return nil
+	}
+
+	switch b.state {
+	case StateClosed:
+		b.requests++
+
+		if result == outcomeSuccess {
+			b.consecutiveFailures = 0
+			return nil
+		}
+
+		b.failures++
+		b.consecutiveFailures++
+
+		if b.shouldTrip(cfg) {
+			return b.setState(StateOpen, now)
+		}
+	case StateHalfOpen:
+		if result == outcomeFailure {
+			return b.setState(StateOpen, now)
+		}
+
+		b.successes++
+
+		if b.successes >= cfg.HalfOpenProbes {
+			return b.setState(StateClosed, now)
+		}
+	}
+
+	return nil
+}
+
+func (b *breaker) shouldTrip(cfg Config) bool {
+	if cfg.ConsecutiveFailures > 0 && b.consecutiveFailures >= cfg.ConsecutiveFailures {
+		return true
+	}
+
+	return cfg.FailureRatio > 0 &&
+		b.requests >= cfg.MinRequests &&
+		float64(b.failures)/float64(b.requests) >= cfg.FailureRatio
+}
+
+func (b *breaker) setState(state State, now time.Time) *transition {
+	t := &transition{from: b.state, to: state}
+
+	b.state = state
+	b.generation++
+	b.resetCounts(now)
+	b.probes = 0
+	b.successes = 0
+
+	if state == StateOpen {
+		b.openedAt = now
+	}
+
+	return t
+}
+
+func (b *breaker) resetCounts(now time.Time) {
+	b.windowStart = now
+	b.requests = 0
+	b.failures = 0
+	b.consecutiveFailures = 0
+}
@@ -0,0 +1,191 @@
+package circuitbreaker_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/tanveerprottoy/stdlib-ext/httpext/internal/backofftest"
+	"github.com/tanveerprottoy/stdlib-ext/httpext/roundtripper"
+	"github.com/tanveerprottoy/stdlib-ext/httpext/roundtripper/circuitbreaker"
+)
+
+func TestRoundTripper(t *testing.T) {
+	var (
+		status      atomic.Int32
+		calls       atomic.Int32
+		transitions []string
+	)
+
+	base := roundtripper.Func(func(req *http.Request) (*http.Response, error) {
+		calls.Add(1)
+		return &http.Response{StatusCode: int(status.Load()), Body: http.NoBody}, nil
+	})
+
+	clock := backofftest.NewClock(time.Now())
+
+	rt := circuitbreaker.NewRoundTripper(
+		circuitbreaker.Config{ConsecutiveFailures: 3, Cooldown: time.Minute, HalfOpenProbes: 1},
+		base,
+		circuitbreaker.WithClock(clock),
+		circuitbreaker.WithOnStateChange(func(key string, from, to circuitbreaker.State) {
+			transitions = append(transitions, from.String()+"->"+to.String())
+		}),
+	)
+
+	do := func() error {
+		req, _ := http.NewRequest(http.MethodGet, "http://example.com/", nil)
+		_, err := rt.RoundTrip(req)
+		return err
+	}
+
+	status.Store(http.StatusServiceUnavailable)
+
+	for i := 0; i < 3; i++ {
+		if err := do(); err != nil {
+			t.Fatalf("request %d: unexpected error %v", i, err)
+		}
+	}
+
+	if s := rt.State("example.com"); s != circuitbreaker.StateOpen {
+		t.Fatalf("expected open circuit, got %v", s)
+	}
+
+	if err := do(); !errors.Is(err, circuitbreaker.ErrOpen) {
+		t.Fatalf("expected ErrOpen, got %v", err)
+	}
+
+	if calls.Load() != 3 {
+		t.Errorf("expected the open circuit to short-circuit, got %d calls", calls.Load())
+	}
+
+	// a failed probe reopens the circuit
+	clock.Advance(time.Minute)
+
+	if err := do(); err != nil {
+		t.Fatalf("probe: unexpected error %v", err)
+	}
+
+	if s := rt.State("example.com"); s != circuitbreaker.StateOpen {
+		t.Fatalf("expected open circuit after failed probe, got %v", s)
+	}
+
+	// a successful probe closes it
+	clock.Advance(time.Minute)
+	status.Store(http.StatusOK)
+
+	if err := do(); err != nil {
+		t.Fatalf("probe: unexpected error %v", err)
+	}
+
+	if s := rt.State("example.com"); s != circuitbreaker.StateClosed {
+		t.Fatalf("expected closed circuit, got %v", s)
+	}
+
+	exp := []string{"closed->open", "open->half-open", "half-open->open", "open->half-open", "half-open->closed"}
+	if len(transitions) != len(exp) {
+		t.Fatalf("transitions = %v; want %v", transitions, exp)
+	}
+
+	for i := range exp {
+		if transitions[i] != exp[i] {
+			t.Errorf("transitions = %v; want %v", transitions, exp)
+			break
+		}
+	}
+}
+
+func TestFailureRatio(t *testing.T) {
+	var n atomic.Int32
+
+	// every other request fails
+	base := roundtripper.Func(func(req *http.Request) (*http.Response, error) {
+		if n.Add(1)%2 == 0 {
+			return nil, errors.New("connection refused")
+		}
+		return &http.Response{StatusCode: http.StatusOK, Body: http.NoBody}, nil
+	})
+
+	rt := circuitbreaker.NewRoundTripper(
+		circuitbreaker.Config{FailureRatio: 0.5, MinRequests: 4, Cooldown: time.Minute},
+		base,
+	)
+
+	for i := 0; i < 4; i++ {
+		req, _ := http.NewRequest(http.MethodGet, "http://example.com/", nil)
+		rt.RoundTrip(req)
+	}
+
+	if s := rt.State("example.com"); s != circuitbreaker.StateOpen {
+		t.Errorf("expected open circuit, got %v", s)
+	}
+
+	if s := rt.State("other.example.com"); s != circuitbreaker.StateClosed {
+		t.Errorf("expected circuits to be per host, got %v", s)
+	}
+}
+
+func TestCancelledRequestsAreIgnored(t *testing.T) {
+	var status atomic.Int32
+
+	// cancelled requests fail like a transport would
+	base := roundtripper.Func(func(req *http.Request) (*http.Response, error) {
+		if err := req.Context().Err(); err != nil {
+			return nil, err
+		}
+
+		return &http.Response{StatusCode: int(status.Load()), Body: http.NoBody}, nil
+	})
+
+	clock := backofftest.NewClock(time.Now())
+
+	rt := circuitbreaker.NewRoundTripper(
+		circuitbreaker.Config{ConsecutiveFailures: 2, Cooldown: time.Minute, HalfOpenProbes: 1},
+		base,
+		circuitbreaker.WithClock(clock),
+	)
+
+	do := func(cancelled bool) error {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		if cancelled {
+			cancel()
+		}
+
+		req, _ := http.NewRequestWithContext(ctx, http.MethodGet, "http://example.com/", nil)
+		_, err := rt.RoundTrip(req)
+
+		return err
+	}
+
+	// a cancelled request doesn't reset the consecutive failures
+	status.Store(http.StatusServiceUnavailable)
+	do(false)
+	do(true)
+	do(false)
+
+	if s := rt.State("example.com"); s != circuitbreaker.StateOpen {
+		t.Fatalf("expected open circuit, got %v", s)
+	}
+
+	// a cancelled probe neither closes the circuit nor uses up the probe slot
+	clock.Advance(time.Minute)
+	status.Store(http.StatusOK)
+	do(true)
+
+	if s := rt.State("example.com"); s != circuitbreaker.StateHalfOpen {
+		t.Fatalf("expected half-open circuit after a cancelled probe, got %v", s)
+	}
+
+	if err := do(false); err != nil {
+		t.Fatalf("probe: unexpected error %v", err)
+	}
+
+	if s := rt.State("example.com"); s != circuitbreaker.StateClosed {
+		t.Errorf("expected closed circuit, got %v", s)
+	}
+}
@@ -0,0 +1,308 @@
+// Package coalesce provides a round tripper which shares one upstream call between identical concurrent requests
+package coalesce
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/tanveerprottoy/stdlib-ext/httpext/roundtripper/timing"
+)
+
+// SharedHeader is set to "1" on responses which were served to more than one caller
+const SharedHeader = "X-Coalesced"
+
+// DefaultKeyHeaders are the request headers which distinguish otherwise identical requests
+var DefaultKeyHeaders = []string{
+	"Accept",
+	"Accept-Encoding",
+	"Accept-Language",
+	"Authorization",
+	"Cookie",
+	"Range",
+}
+
+// DefaultMaxBodySize is the largest response body which is shared between callers
+const DefaultMaxBodySize = 1 << 20 // 1 MiB
+
+type Option func(*RoundTripper)
+
+// WithKeyHeaders replaces the request headers which are part of the key
+func WithKeyHeaders(names ...string) Option {
+	return func(rt *RoundTripper) {
+		rt.keyHeaders = make([]string, len(names))
+		for i, name := range names {
+			rt.keyHeaders[i] = http.CanonicalHeaderKey(name)
+		}
+	}
+}
+
+// WithMaxBodySize sets the largest response body which is buffered and shared between callers
+func WithMaxBodySize(n int64) Option {
+	return func(rt *RoundTripper) {
+		rt.maxBodySize = n
+	}
+}
+
+// RoundTripper deduplicates in-flight GET and HEAD requests without a body, keyed by
+// method, URL and the key headers. One upstream call serves every waiter, its response
+// body is read completely and each waiter receives an independent copy.
+// Larger bodies than the maximum body size are streamed to one waiter, the others send
+// their requests on their own. The upstream call is canceled only once every waiter gave up
+type RoundTripper struct {
+	keyHeaders  []string
+	maxBodySize int64
+
+	mu       sync.Mutex
+	inflight map[string]*call
+
+	base http.RoundTripper
+}
+
+// call is an upstream request shared by concurrent callers
+type call struct {
+	done    chan struct{}
+	waiters int
+	cancel  context.CancelFunc
+
+	resp   *http.Response // body already read into body
+	body   []byte
+	err    error
+	shared bool // more than one caller was waiting when the call completed
+
+	// stream is a response too large to share, it is handed to the first waiter
+	stream  *http.Response
+	claimed bool
+}
+
+// NewRoundTripper creates a new coalescing RoundTripper.
+// If base is nil, http.DefaultTransport is used.
+func NewRoundTripper(base http.RoundTripper, opts ...Option) *RoundTripper {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+
+	rt := &RoundTripper{
+		keyHeaders:  DefaultKeyHeaders,
+		maxBodySize: DefaultMaxBodySize,
+		inflight:    make(map[string]*call),
+		base:        base,
+	}
+
+	for _, opt := range opts {
+		opt(rt)
+	}
+
+	return rt
+}
+
+// Middleware returns a roundtripper.Middleware which wraps its base with a coalescing RoundTripper
+func Middleware(opts ...Option) func(http.RoundTripper) http.RoundTripper {
+	return func(base http.RoundTripper) http.RoundTripper {
+		return NewRoundTripper(base, opts...)
+	}
+}
+
+func (rt *RoundTripper) key(req *http.Request) string {
+	var b strings.Builder
+	b.WriteString(req.Method + " " + req.URL.String())
+
+	for _, name := range rt.keyHeaders {
+		b.WriteString("\n" + name + ": " + strings.Join(req.Header.Values(name), ", "))
+	}
+
+	return b.String()
+}
+
+func (rt *RoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	if (req.Method != http.MethodGet && req.Method != http.MethodHead) ||
+		(req.Body != nil && req.Body != http.NoBody) {
+		return rt.base.RoundTrip(req)
+	}
+
+	key := rt.key(req)
+
+	rt.mu.Lock()
+	c, ok := rt.inflight[key]
+	if ok {
+		c.waiters++
+	} else {
+		c = rt.start(key, req)
+	}
+	rt.mu.Unlock()
+
+	select {
+	case <-c.done:
+		if c.err != nil {
+			return nil, c.err
+		}
+
+		if c.stream == nil {
+			return c.response(req), nil
+		}
+
+		if resp, ok := rt.claim(c, req); ok {
+			return resp, nil
+		}
+
+		// the response is too large to share, send the request on its own
+		return rt.base.RoundTrip(req)
+	case <-req.Context().Done():
+		rt.mu.Lock()
+		c.waiters--
+		if c.waiters == 0 {
+			// later callers must not join a canceled call
+			rt.forget(key, c)
+			c.release()
+		}
+		rt.mu.Unlock()
+
+		return nil, req.Context().Err()
+	}
+}
+
+// start sends req upstream on behalf of every caller with the same key, rt.mu must be held
+func (rt *RoundTripper) start(key string, req *http.Request) *call {
+	// the call outlives the first caller, it keeps its values but neither its deadline nor its
+	// cancellation. Every waiter gives up on its own, the call is canceled once none is left
+	ctx, cancel := context.WithCancel(context.WithoutCancel(req.Context()))
+
+	c := &call{done: make(chan struct{}), waiters: 1, cancel: cancel}
+	rt.inflight[key] = c
+
+	go func() {
+		resp, body, stream, err := rt.do(req.Clone(ctx))
+
+		rt.mu.Lock()
+		rt.forget(key, c)
+		c.resp, c.body, c.stream, c.err = resp, body, stream, err
+		c.shared = c.waiters > 1
+
+		// a streamed body keeps the call alive until it is closed
+		if c.stream == nil || c.waiters == 0 {
+			c.release()
+		}
+		rt.mu.Unlock()
+
+		close(c.done)
+	}()
+
+	return c
+}
+
+// forget removes c from the in-flight calls unless it was replaced already, rt.mu must be held
+func (rt *RoundTripper) forget(key string, c *call) {
+	if rt.inflight[key] == c {
+		delete(rt.inflight, key)
+	}
+}
+
+// do sends req and reads the response body completely, a response whose body is larger
+// than the maximum body size is returned unread as stream
+func (rt *RoundTripper) do(req *http.Request) (resp *http.Response, body []byte, stream *http.Response, err error) {
+	resp, err = rt.base.RoundTrip(req)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	if resp.ContentLength > rt.maxBodySize {
+		return nil, nil, resp, nil
+	}
+
+	// read one byte past the limit to know whether a body of unknown length fits
+	body, err = io.ReadAll(io.LimitReader(resp.Body, rt.maxBodySize+1))
+	if err != nil {
+		resp.Body.Close()
+		return nil, nil, nil, err
+	}
+
+	if int64(len(body)) > rt.maxBodySize {
+		resp.Body = &readCloser{Reader: io.MultiReader(bytes.NewReader(body), resp.Body), Closer: resp.Body}
+		return nil, nil, resp, nil
+	}
+
+	resp.Body.Close()
+
+	return resp, body, nil, nil
+}
+
+// claim hands the streamed response of c to req, only the first caller succeeds
+func (rt *RoundTripper) claim(c *call, req *http.Request) (*http.Response, bool) {
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+
+	if c.claimed {
+		return nil, false
+	}
+
+	c.claimed = true
+
+	// the call doesn't follow the caller's cancellation by itself
+	stop := context.AfterFunc(req.Context(), c.cancel)
+
+	resp := c.stream
+	body := resp.Body
+
+	resp.Request = callerRequest(req, resp)
+	resp.Body = &readCloser{Reader: body, Closer: closerFunc(func() error {
+		stop()
+		defer c.cancel()
+
+		return body.Close()
+	})}
+
+	return resp, true
+}
+
+// release closes an unclaimed stream and cancels the call, rt.mu must be held
+func (c *call) release() {
+	if c.stream != nil && !c.claimed {
+		c.claimed = true
+		c.stream.Body.Close()
+	}
+
+	c.cancel()
+}
+
+// response returns a copy of the shared response for req
+func (c *call) response(req *http.Request) *http.Response {
+	resp := *c.resp
+	resp.Header = c.resp.Header.Clone()
+	resp.Trailer = c.resp.Trailer.Clone()
+	resp.Body = io.NopCloser(bytes.NewReader(c.body))
+	resp.Request = callerRequest(req, c.resp)
+
+	if req.Method != http.MethodHead {
+		resp.ContentLength = int64(len(c.body))
+	}
+
+	if c.shared {
+		resp.Header.Set(SharedHeader, "1")
+	}
+
+	return &resp
+}
+
+// callerRequest returns req as the request of the upstream response, it carries the timings of
+// the upstream call since they were recorded with the context of the first caller
+func callerRequest(req *http.Request, upstream *http.Response) *http.Request {
+	if ctx := timing.WithResponseTimings(req.Context(), upstream); ctx != req.Context() {
+		return req.WithContext(ctx)
+	}
+
+	return req
+}
+
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
+
+type closerFunc func() error
+
+func (f closerFunc) Close() error {
+	return f()
+}
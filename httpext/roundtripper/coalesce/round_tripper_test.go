@@ -0,0 +1,249 @@
+package coalesce_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/tanveerprottoy/stdlib-ext/httpext/roundtripper"
+	"github.com/tanveerprottoy/stdlib-ext/httpext/roundtripper/coalesce"
+)
+
+func TestRoundTripper(t *testing.T) {
+	var calls atomic.Int32
+
+	release := make(chan struct{})
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		<-release
+		w.Write([]byte("payload"))
+	}))
+	defer srv.Close()
+
+	// subtest testIdenticalRequestsShareOneCall
+	t.Run("testIdenticalRequestsShareOneCall", func(t *testing.T) {
+		calls.Store(0)
+		rt := coalesce.NewRoundTripper(nil)
+
+		const n = 10
+
+		var (
+			wg     sync.WaitGroup
+			bodies [n]string
+			shared atomic.Int32
+		)
+
+		for i := range n {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+
+				req, _ := http.NewRequest(http.MethodGet, srv.URL+"/same", nil)
+
+				resp, err := rt.RoundTrip(req)
+				if err != nil {
+					t.Errorf("RoundTrip error: %v", err)
+					return
+				}
+				defer resp.Body.Close()
+
+				if resp.Header.Get(coalesce.SharedHeader) == "1" {
+					shared.Add(1)
+				}
+
+				b, _ := io.ReadAll(resp.Body)
+				bodies[i] = string(b)
+			}()
+		}
+
+		// let the requests pile up behind the first one
+		time.Sleep(100 * time.Millisecond)
+		close(release)
+		wg.Wait()
+
+		if calls.Load() != 1 {
+			t.Errorf("expected 1 upstream call, got %d", calls.Load())
+		}
+
+		for i, body := range bodies {
+			if body != "payload" {
+				t.Errorf("waiter %d: expected body payload, got %q", i, body)
+			}
+		}
+
+		if shared.Load() != n {
+			t.Errorf("expected %d shared responses, got %d", n, shared.Load())
+		}
+	})
+
+	// subtest testKeyHeadersSeparateRequests
+	t.Run("testKeyHeadersSeparateRequests", func(t *testing.T) {
+		calls.Store(0)
+		rt := coalesce.NewRoundTripper(nil)
+
+		var wg sync.WaitGroup
+
+		for _, token := range []string{"Bearer a", "Bearer b"} {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+
+				req, _ := http.NewRequest(http.MethodGet, srv.URL+"/auth", nil)
+				req.Header.Set("Authorization", token)
+
+				resp, err := rt.RoundTrip(req)
+				if err != nil {
+					t.Errorf("RoundTrip error: %v", err)
+					return
+				}
+				resp.Body.Close()
+			}()
+		}
+
+		wg.Wait()
+
+		if calls.Load() != 2 {
+			t.Errorf("expected 2 upstream calls, got %d", calls.Load())
+		}
+	})
+
+	// subtest testLargeBodiesAreNotShared
+	t.Run("testLargeBodiesAreNotShared", func(t *testing.T) {
+		var (
+			large    atomic.Int32
+			released = make(chan struct{})
+			payload  = strings.Repeat("x", 4096)
+		)
+
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			// the first call waits for the others to pile up behind it
+			if large.Add(1) == 1 {
+				<-released
+			}
+
+			// without a Content-Length the size is only known once the body is read
+			w.(http.Flusher).Flush()
+			w.Write([]byte(payload))
+		}))
+		defer srv.Close()
+
+		rt := coalesce.NewRoundTripper(nil, coalesce.WithMaxBodySize(1024))
+
+		const n = 3
+
+		var (
+			wg     sync.WaitGroup
+			bodies [n]string
+		)
+
+		for i := range n {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+
+				req, _ := http.NewRequest(http.MethodGet, srv.URL+"/large", nil)
+
+				resp, err := rt.RoundTrip(req)
+				if err != nil {
+					t.Errorf("RoundTrip error: %v", err)
+					return
+				}
+				defer resp.Body.Close()
+
+				if resp.Header.Get(coalesce.SharedHeader) != "" {
+					t.Errorf("expected a large response not to be shared")
+				}
+
+				b, _ := io.ReadAll(resp.Body)
+				bodies[i] = string(b)
+			}()
+		}
+
+		time.Sleep(100 * time.Millisecond)
+		close(released)
+		wg.Wait()
+
+		for i, body := range bodies {
+			if body != payload {
+				t.Errorf("waiter %d: expected the complete body, got %d bytes", i, len(body))
+			}
+		}
+
+		// one caller streams the coalesced call, the others fall back to their own
+		if large.Load() != n {
+			t.Errorf("expected %d upstream calls, got %d", n, large.Load())
+		}
+	})
+
+	// subtest testFirstCallersDeadlineIsNotShared
+	t.Run("testFirstCallersDeadlineIsNotShared", func(t *testing.T) {
+		rt := coalesce.NewRoundTripper(roundtripper.Func(func(req *http.Request) (*http.Response, error) {
+			select {
+			case <-time.After(150 * time.Millisecond):
+			case <-req.Context().Done():
+				return nil, req.Context().Err()
+			}
+
+			return &http.Response{StatusCode: http.StatusOK, Body: io.NopCloser(strings.NewReader("payload")), Request: req}, nil
+		}))
+
+		short, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+
+		first, _ := http.NewRequestWithContext(short, http.MethodGet, "http://example.com/deadline", nil)
+		second, _ := http.NewRequest(http.MethodGet, "http://example.com/deadline", nil)
+
+		errs := make(chan error, 1)
+		go func() {
+			_, err := rt.RoundTrip(first)
+			errs <- err
+		}()
+
+		// let the second caller join the call of the first
+		time.Sleep(10 * time.Millisecond)
+
+		resp, err := rt.RoundTrip(second)
+		if err != nil {
+			t.Fatalf("expected the second caller to get the response, got %v", err)
+		}
+		resp.Body.Close()
+
+		if err := <-errs; !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("expected the first caller's deadline to end its wait, got %v", err)
+		}
+	})
+
+	// subtest testWaiterCancellation
+	t.Run("testWaiterCancellation", func(t *testing.T) {
+		calls.Store(0)
+
+		block := make(chan struct{})
+		defer close(block)
+
+		rt := coalesce.NewRoundTripper(roundtripper.Func(func(req *http.Request) (*http.Response, error) {
+			calls.Add(1)
+			select {
+			case <-block:
+			case <-req.Context().Done():
+			}
+			return nil, req.Context().Err()
+		}))
+
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+
+		req, _ := http.NewRequestWithContext(ctx, http.MethodGet, "http://example.com", nil)
+
+		if _, err := rt.RoundTrip(req); !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("expected context.DeadlineExceeded, got %v", err)
+		}
+	})
+}
@@ -0,0 +1,159 @@
+package headers
+
+import (
+	"fmt"
+	"net/http"
+	"runtime"
+	"strings"
+)
+
+// ValueFunc computes a header value per request, an empty value leaves the header untouched
+type ValueFunc func(req *http.Request) string
+
+// Static returns a ValueFunc which always returns value
+func Static(value string) ValueFunc {
+	return func(*http.Request) string {
+		return value
+	}
+}
+
+// FromContext returns a ValueFunc which reads a string or fmt.Stringer stored
+// in the request context under key, e.g. a request or tenant ID
+func FromContext(key any) ValueFunc {
+	return func(req *http.Request) string {
+		switch v := req.Context().Value(key).(type) {
+		case string:
+			return v
+		case fmt.Stringer:
+			return v.String()
+		default:
+			return ""
+		}
+	}
+}
+
+// UserAgent builds a User-Agent value like "product/version (comment; comment) go/1.22"
+func UserAgent(product, version string, comments ...string) string {
+	var b strings.Builder
+
+	b.WriteString(product)
+
+	if version != "" {
+		b.WriteString("/" + version)
+	}
+
+	if len(comments) > 0 {
+		b.WriteString(" (" + strings.Join(comments, "; ") + ")")
+	}
+
+	b.WriteString(" go/" + strings.TrimPrefix(runtime.Version(), "go"))
+
+	return b.String()
+}
+
+type opKind int
+
+const (
+	opSet opKind = iota
+	opAdd
+	opDel
+)
+
+// op is a single header operation, applied in the order the options were given
+type op struct {
+	kind  opKind
+	name  string
+	value ValueFunc
+}
+
+type Option func(*RoundTripper)
+
+// Set replaces the header name with a static value
+func Set(name, value string) Option {
+	return SetFunc(name, Static(value))
+}
+
+// SetFunc replaces the header name with the value computed for each request
+func SetFunc(name string, f ValueFunc) Option {
+	return func(rt *RoundTripper) {
+		rt.ops = append(rt.ops, op{kind: opSet, name: name, value: f})
+	}
+}
+
+// Add appends a static value to the header name
+func Add(name, value string) Option {
+	return AddFunc(name, Static(value))
+}
+
+// AddFunc appends the value computed for each request to the header name
+func AddFunc(name string, f ValueFunc) Option {
+	return func(rt *RoundTripper) {
+		rt.ops = append(rt.ops, op{kind: opAdd, name: name, value: f})
+	}
+}
+
+// Remove deletes the headers
+func Remove(names ...string) Option {
+	return func(rt *RoundTripper) {
+		for _, name := range names {
+			rt.ops = append(rt.ops, op{kind: opDel, name: name})
+		}
+	}
+}
+
+// RoundTripper sets, appends or removes headers on every request.
+// The headers are changed on a clone, the caller's request is never mutated
+type RoundTripper struct {
+	ops []op
+
+	base http.RoundTripper
+}
+
+// NewRoundTripper creates a new header RoundTripper.
+// If base is nil, http.DefaultTransport is used.
+func NewRoundTripper(base http.RoundTripper, opts ...Option) *RoundTripper {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+
+	rt := &RoundTripper{base: base}
+
+	for _, opt := range opts {
+		opt(rt)
+	}
+
+	return rt
+}
+
+// Middleware returns a roundtripper.Middleware which wraps its base with a header RoundTripper
+func Middleware(opts ...Option) func(http.RoundTripper) http.RoundTripper {
+	return func(base http.RoundTripper) http.RoundTripper {
+		return NewRoundTripper(base, opts...)
+	}
+}
+
+func (rt *RoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	if len(rt.ops) == 0 {
+		return rt.base.RoundTrip(req)
+	}
+
+	// Clone deep copies the headers, the body is shared
+	clone := req.Clone(req.Context())
+
+	for _, o := range rt.ops {
+		switch o.kind {
+		case opDel:
+			clone.Header.Del(o.name)
+		case opSet:
+			if v := o.value(req); v != "" {
+				clone.Header.Set(o.name, v)
+			}
+		case opAdd:
+			if v := o.value(req); v != "" {
+				clone.Header.Add(o.name, v)
+			}
+		}
+	}
+
+	return rt.base.RoundTrip(clone)
+}
@@ -0,0 +1,61 @@
+package headers_test
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/tanveerprottoy/stdlib-ext/httpext/roundtripper"
+	"github.com/tanveerprottoy/stdlib-ext/httpext/roundtripper/headers"
+)
+
+type requestIDKey struct{}
+
+func TestRoundTripper(t *testing.T) {
+	var sent http.Header
+
+	base := roundtripper.Func(func(req *http.Request) (*http.Response, error) {
+		sent = req.Header
+		return &http.Response{StatusCode: http.StatusOK, Body: http.NoBody}, nil
+	})
+
+	rt := headers.NewRoundTripper(
+		base,
+		headers.Set("User-Agent", headers.UserAgent("stdlib-ext", "1.0", "linux")),
+		headers.SetFunc("X-Request-Id", headers.FromContext(requestIDKey{})),
+		headers.Add("Accept", "application/xml"),
+		headers.Remove("X-Debug"),
+	)
+
+	ctx := context.WithValue(context.Background(), requestIDKey{}, "req-1")
+
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, "http://example.com", nil)
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("X-Debug", "1")
+
+	if _, err := rt.RoundTrip(req); err != nil {
+		t.Fatalf("RoundTrip error: %v", err)
+	}
+
+	if ua := sent.Get("User-Agent"); !strings.HasPrefix(ua, "stdlib-ext/1.0 (linux) go/") {
+		t.Errorf("User-Agent = %q", ua)
+	}
+
+	if id := sent.Get("X-Request-Id"); id != "req-1" {
+		t.Errorf("X-Request-Id = %q; want req-1", id)
+	}
+
+	if accept := sent.Values("Accept"); len(accept) != 2 {
+		t.Errorf("Accept = %v; want both values", accept)
+	}
+
+	if sent.Get("X-Debug") != "" {
+		t.Errorf("expected X-Debug to be removed")
+	}
+
+	// the caller's request is left alone
+	if len(req.Header.Values("Accept")) != 1 || req.Header.Get("X-Debug") != "1" || req.Header.Get("X-Request-Id") != "" {
+		t.Errorf("the caller's request must not be mutated: %v", req.Header)
+	}
+}
@@ -0,0 +1,316 @@
+// Package hedge provides a round tripper which sends hedged requests to cut tail latency
+package hedge
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/tanveerprottoy/stdlib-ext/httpext/backoff"
+	"github.com/tanveerprottoy/stdlib-ext/httpext/roundtripper/retry"
+)
+
+// budgetBurst is the maximum number of hedges saved up by the budget
+const budgetBurst = 10
+
+type Config struct {
+	Delay       time.Duration // wait before hedging, used until enough latencies are learned when Percentile is set
+	Percentile  float64       // hedge after this percentile (0, 1) of recent latencies, e.g. 0.95, 0 disables learning
+	MinSamples  int           // latencies needed before Percentile is used, 20 by default
+	Window      int           // number of recent latencies kept, 100 by default
+	MaxHedges   int           // additional requests per request, 1 by default
+	BudgetRatio float64       // hedges allowed per request over time, 0.1 (10%) by default
+}
+
+type Option func(*RoundTripper)
+
+// WithClock sets the clock used for the hedge delay and latency measurements
+func WithClock(c backoff.Clock) Option {
+	return func(rt *RoundTripper) {
+		rt.clock = c
+	}
+}
+
+// RoundTripper sends an identical request when the previous one hasn't answered after
+// the hedge delay, returns whichever succeeds first and cancels the others.
+// Only idempotent requests whose body can be replayed are hedged, and a budget
+// limits the share of hedged requests so that a slow server isn't overloaded
+type RoundTripper struct {
+	cfg    Config
+	clock  backoff.Clock
+	policy retry.Policy // decides which responses lose to another attempt in flight
+
+	mu        sync.Mutex
+	latencies []time.Duration // ring buffer of recent latencies
+	next      int
+	tokens    float64
+
+	base http.RoundTripper
+}
+
+// NewRoundTripper creates a new hedging RoundTripper.
+// If base is nil, http.DefaultTransport is used.
+func NewRoundTripper(cfg Config, base http.RoundTripper, opts ...Option) *RoundTripper {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+
+	// sanitize the config, hedging needs a delay or a percentile to learn it from
+	if cfg.Delay <= 0 && (cfg.Percentile <= 0 || cfg.Percentile >= 1) {
+		cfg.Percentile = 0.95
+	}
+
+	if cfg.Percentile < 0 || cfg.Percentile >= 1 {
+		cfg.Percentile = 0
+	}
+
+	if cfg.MinSamples <= 0 {
+		cfg.MinSamples = 20
+	}
+
+	if cfg.Window < cfg.MinSamples {
+		cfg.Window = max(100, cfg.MinSamples)
+	}
+
+	if cfg.MaxHedges <= 0 {
+		cfg.MaxHedges = 1
+	}
+
+	if cfg.BudgetRatio <= 0 {
+		cfg.BudgetRatio = 0.1
+	}
+
+	rt := &RoundTripper{
+		cfg:       cfg,
+		clock:     backoff.SystemClock(),
+		policy:    retry.DefaultPolicy(),
+		latencies: make([]time.Duration, 0, cfg.Window),
+		tokens:    budgetBurst,
+		base:      base,
+	}
+
+	for _, opt := range opts {
+		opt(rt)
+	}
+
+	return rt
+}
+
+// Middleware returns a roundtripper.Middleware which wraps its base with a hedging RoundTripper
+func Middleware(cfg Config, opts ...Option) func(http.RoundTripper) http.RoundTripper {
+	return func(base http.RoundTripper) http.RoundTripper {
+		return NewRoundTripper(cfg, base, opts...)
+	}
+}
+
+// Delay returns the current hedge delay, 0 means requests are not hedged
+func (rt *RoundTripper) Delay() time.Duration {
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+
+	if rt.cfg.Percentile == 0 || len(rt.latencies) < rt.cfg.MinSamples {
+		return rt.cfg.Delay
+	}
+
+	sorted := slices.Clone(rt.latencies)
+	slices.Sort(sorted)
+
+	return sorted[int(rt.cfg.Percentile*float64(len(sorted)-1))]
+}
+
+func (rt *RoundTripper) observe(latency time.Duration) {
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+
+	if len(rt.latencies) < rt.cfg.Window {
+		rt.latencies = append(rt.latencies, latency)
+		return
+	}
+
+	rt.latencies[rt.next] = latency
+	rt.next = (rt.next + 1) % rt.cfg.Window
+}
+
+// earn adds the budget share of a request
+func (rt *RoundTripper) earn() {
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+
+	rt.tokens = min(budgetBurst, rt.tokens+rt.cfg.BudgetRatio)
+}
+
+// spend takes the budget for one hedge
+func (rt *RoundTripper) spend() bool {
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+
+	if rt.tokens < 1 {
+		return false
+	}
+
+	rt.tokens--
+
+	return true
+}
+
+type result struct {
+	attempt int
+	resp    *http.Response
+	err     error
+}
+
+func (rt *RoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	rt.earn()
+
+	delay := rt.Delay()
+
+	// an Idempotency-Key doesn't make a request hedgeable, servers reject concurrent duplicates
+	hedgeable := delay > 0 && retry.IsIdempotentMethod(req.Method) &&
+		(req.Body == nil || req.Body == http.NoBody || req.GetBody != nil)
+
+	if !hedgeable {
+		start := rt.clock.Now()
+
+		resp, err := rt.base.RoundTrip(req)
+		if err == nil {
+			rt.observe(rt.clock.Now().Sub(start))
+		}
+
+		return resp, err
+	}
+
+	// buffered so that losers never block
+	results := make(chan result, 1+rt.cfg.MaxHedges)
+
+	var cancels []context.CancelFunc
+
+	launch := func(attemptReq *http.Request) {
+		ctx, cancel := context.WithCancel(req.Context())
+		attempt := len(cancels)
+		cancels = append(cancels, cancel)
+
+		go func() {
+			resp, err := rt.base.RoundTrip(attemptReq.WithContext(ctx))
+			results <- result{attempt: attempt, resp: resp, err: err}
+		}()
+	}
+
+	// the latency is what the caller waited, a winning hedge must not shorten it
+	start := rt.clock.Now()
+
+	launch(req)
+
+	var (
+		inflight = 1
+		sent     = 1
+		timer    = rt.clock.After(delay)
+		lastErr  error
+		fallback *result // a retryable response, returned when no other attempt succeeds
+	)
+
+	win := func(r result) (*http.Response, error) {
+		rt.observe(rt.clock.Now().Sub(start))
+
+		// cancel the losers and close whatever they still return
+		for i, cancel := range cancels {
+			if i != r.attempt {
+				cancel()
+			}
+		}
+
+		go discard(results, inflight)
+
+		// the winner's context lives until its body is closed
+		r.resp.Body = &cancelBody{ReadCloser: r.resp.Body, cancel: cancels[r.attempt]}
+
+		return r.resp, nil
+	}
+
+	for {
+		select {
+		case r := <-results:
+			inflight--
+
+			switch {
+			case r.err != nil:
+				cancels[r.attempt]()
+				lastErr = r.err
+			case (inflight > 0 || fallback != nil) && rt.policy.ShouldRetry(req, r.resp, nil):
+				// a retryable response, e.g. a fast 503, loses while another attempt may still succeed
+				if fallback == nil {
+					fallback = &r
+				} else {
+					drain(r.resp)
+					cancels[r.attempt]()
+				}
+			default:
+				if fallback != nil {
+					drain(fallback.resp)
+				}
+
+				return win(r)
+			}
+
+			if inflight == 0 {
+				if fallback != nil {
+					return win(*fallback)
+				}
+
+				return nil, lastErr
+			}
+		case <-timer:
+			timer = nil
+
+			if sent > rt.cfg.MaxHedges || !rt.spend() {
+				continue
+			}
+
+			hedgeReq := req.Clone(req.Context())
+			if req.GetBody != nil {
+				body, err := req.GetBody()
+				if err != nil {
+					continue
+				}
+
+				hedgeReq.Body = body
+			}
+
+			launch(hedgeReq)
+			inflight++
+			sent++
+
+			timer = rt.clock.After(delay)
+		}
+	}
+}
+
+// discard closes the responses of the remaining attempts
+func discard(results <-chan result, n int) {
+	for range n {
+		if r := <-results; r.resp != nil {
+			drain(r.resp)
+		}
+	}
+}
+
+// drain reads and closes the body of a losing response
+func drain(resp *http.Response) {
+	io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+}
+
+// cancelBody cancels the context of its request when it's closed
+type cancelBody struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (b *cancelBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.cancel()
+
+	return err
+}
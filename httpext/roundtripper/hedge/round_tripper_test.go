@@ -0,0 +1,210 @@
+package hedge_test
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/tanveerprottoy/stdlib-ext/httpext/internal/backofftest"
+	"github.com/tanveerprottoy/stdlib-ext/httpext/roundtripper"
+	"github.com/tanveerprottoy/stdlib-ext/httpext/roundtripper/hedge"
+	"github.com/tanveerprottoy/stdlib-ext/httpext/roundtripper/retry"
+)
+
+func TestRoundTripper(t *testing.T) {
+	var (
+		calls    atomic.Int32
+		canceled atomic.Int32
+	)
+
+	// the first request is slow, the hedged one answers at once
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) == 1 {
+			select {
+			case <-r.Context().Done():
+				canceled.Add(1)
+				return
+			case <-time.After(5 * time.Second):
+			}
+		}
+
+		w.Write([]byte("fast"))
+	}))
+	defer srv.Close()
+
+	// subtest testHedgeWinsAndLoserIsCanceled
+	t.Run("testHedgeWinsAndLoserIsCanceled", func(t *testing.T) {
+		calls.Store(0)
+		rt := hedge.NewRoundTripper(hedge.Config{Delay: 20 * time.Millisecond}, nil)
+
+		req, _ := http.NewRequest(http.MethodGet, srv.URL, nil)
+
+		start := time.Now()
+
+		resp, err := rt.RoundTrip(req)
+		if err != nil {
+			t.Fatalf("RoundTrip error: %v", err)
+		}
+
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+
+		if string(body) != "fast" || time.Since(start) > 2*time.Second {
+			t.Errorf("expected the hedged response, got %q after %v", body, time.Since(start))
+		}
+
+		if calls.Load() != 2 {
+			t.Errorf("expected 2 calls, got %d", calls.Load())
+		}
+
+		deadline := time.Now().Add(2 * time.Second)
+		for canceled.Load() == 0 && time.Now().Before(deadline) {
+			time.Sleep(10 * time.Millisecond)
+		}
+
+		if canceled.Load() != 1 {
+			t.Errorf("expected the slow request to be canceled")
+		}
+	})
+
+	// subtest testLatencyIsMeasuredFromTheFirstAttempt
+	t.Run("testLatencyIsMeasuredFromTheFirstAttempt", func(t *testing.T) {
+		var sent atomic.Int32
+
+		// the first attempt hangs, the hedge answers at once
+		rt := hedge.NewRoundTripper(hedge.Config{Delay: 20 * time.Millisecond, Percentile: 0.5, MinSamples: 1}, roundtripper.Func(func(req *http.Request) (*http.Response, error) {
+			if sent.Add(1) == 1 {
+				<-req.Context().Done()
+				return nil, req.Context().Err()
+			}
+
+			return &http.Response{StatusCode: http.StatusOK, Body: http.NoBody, Request: req}, nil
+		}))
+
+		req, _ := http.NewRequest(http.MethodGet, "http://example.com", nil)
+
+		resp, err := rt.RoundTrip(req)
+		if err != nil {
+			t.Fatalf("RoundTrip error: %v", err)
+		}
+		resp.Body.Close()
+
+		if rt.Delay() < 20*time.Millisecond {
+			t.Errorf("expected the learned delay to include the hedge delay, got %v", rt.Delay())
+		}
+	})
+
+	// subtest testRetryableResponseLoses
+	t.Run("testRetryableResponseLoses", func(t *testing.T) {
+		var sent atomic.Int32
+
+		// the first attempt answers slowly with 200, the hedge at once with 503
+		rt := hedge.NewRoundTripper(hedge.Config{Delay: 10 * time.Millisecond}, roundtripper.Func(func(req *http.Request) (*http.Response, error) {
+			if sent.Add(1) == 1 {
+				time.Sleep(50 * time.Millisecond)
+				return &http.Response{StatusCode: http.StatusOK, Body: http.NoBody, Request: req}, nil
+			}
+
+			return &http.Response{StatusCode: http.StatusServiceUnavailable, Body: http.NoBody, Request: req}, nil
+		}))
+
+		req, _ := http.NewRequest(http.MethodGet, "http://example.com", nil)
+
+		resp, err := rt.RoundTrip(req)
+		if err != nil {
+			t.Fatalf("RoundTrip error: %v", err)
+		}
+		resp.Body.Close()
+
+		if resp.StatusCode != http.StatusOK {
+			t.Errorf("expected the slower 200 to win over a 503, got %d", resp.StatusCode)
+		}
+	})
+
+	// subtest testNonIdempotentIsNotHedged
+	t.Run("testNonIdempotentIsNotHedged", func(t *testing.T) {
+		var sent atomic.Int32
+
+		rt := hedge.NewRoundTripper(hedge.Config{Delay: time.Nanosecond}, roundtripper.Func(func(req *http.Request) (*http.Response, error) {
+			sent.Add(1)
+			time.Sleep(20 * time.Millisecond)
+			return &http.Response{StatusCode: http.StatusOK, Body: http.NoBody, Request: req}, nil
+		}))
+
+		req, _ := http.NewRequest(http.MethodPost, srv.URL, strings.NewReader("x"))
+		req.GetBody = func() (io.ReadCloser, error) {
+			return io.NopCloser(strings.NewReader("x")), nil
+		}
+
+		// the key lets a POST be retried, not be sent twice at the same time
+		req.Header.Set(retry.IdempotencyKeyHeader, "key")
+
+		resp, err := rt.RoundTrip(req)
+		if err != nil {
+			t.Fatalf("RoundTrip error: %v", err)
+		}
+		resp.Body.Close()
+
+		if sent.Load() != 1 {
+			t.Errorf("expected 1 call, got %d", sent.Load())
+		}
+	})
+
+	// subtest testBudget
+	t.Run("testBudget", func(t *testing.T) {
+		var sent atomic.Int32
+
+		rt := hedge.NewRoundTripper(hedge.Config{Delay: time.Millisecond, BudgetRatio: 0.01}, roundtripper.Func(func(req *http.Request) (*http.Response, error) {
+			sent.Add(1)
+			time.Sleep(10 * time.Millisecond)
+			return &http.Response{StatusCode: http.StatusOK, Body: http.NoBody, Request: req}, nil
+		}))
+
+		for range 20 {
+			req, _ := http.NewRequest(http.MethodGet, "http://example.com", nil)
+
+			resp, err := rt.RoundTrip(req)
+			if err != nil {
+				t.Fatalf("RoundTrip error: %v", err)
+			}
+			resp.Body.Close()
+		}
+
+		// 20 requests plus at most the 10 hedges saved up initially
+		if hedges := sent.Load() - 20; hedges > 10 {
+			t.Errorf("expected at most 10 hedges, got %d", hedges)
+		}
+	})
+}
+
+func TestDelayLearnsPercentile(t *testing.T) {
+	// every request takes one step
+	clock := backofftest.NewClock(time.Now())
+	clock.Step = 10 * time.Millisecond
+
+	rt := hedge.NewRoundTripper(hedge.Config{Percentile: 0.5, MinSamples: 3}, roundtripper.Func(func(req *http.Request) (*http.Response, error) {
+		return &http.Response{StatusCode: http.StatusOK, Body: http.NoBody, Request: req}, nil
+	}), hedge.WithClock(clock))
+
+	if rt.Delay() != 0 {
+		t.Errorf("expected no delay before enough samples, got %v", rt.Delay())
+	}
+
+	for range 3 {
+		req, _ := http.NewRequest(http.MethodGet, "http://example.com", nil)
+
+		resp, err := rt.RoundTrip(req)
+		if err != nil {
+			t.Fatalf("RoundTrip error: %v", err)
+		}
+		resp.Body.Close()
+	}
+
+	if rt.Delay() != 10*time.Millisecond {
+		t.Errorf("expected the learned delay 10ms, got %v", rt.Delay())
+	}
+}
@@ -27,6 +27,13 @@ func NewLoggingHeaderRoundTripper(headerName, headerValue string, base http.Roun
 	}
 }
 
+// HeaderMiddleware returns a roundtripper.Middleware which wraps its base with a LoggingHeaderRoundTripper
+func HeaderMiddleware(headerName, headerValue string) func(http.RoundTripper) http.RoundTripper {
+	return func(base http.RoundTripper) http.RoundTripper {
+		return NewLoggingHeaderRoundTripper(headerName, headerValue, base)
+	}
+}
+
 // RoundTrip adds a header, executes the request using the Proxied RoundTripper,
 // and logs the duration.
 func (rt *LoggingHeaderRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
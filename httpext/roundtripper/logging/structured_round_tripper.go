@@ -0,0 +1,315 @@
+package logging
+
+import (
+	"bytes"
+	"io"
+	"log/slog"
+	"math/rand/v2"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/tanveerprottoy/stdlib-ext/httpext/roundtripper/retry"
+	"github.com/tanveerprottoy/stdlib-ext/httpext/roundtripper/timing"
+)
+
+// redacted replaces sensitive header and query values
+const redacted = "REDACTED"
+
+// DefaultRedactedHeaders are the headers whose values are never logged
+var DefaultRedactedHeaders = []string{
+	"Authorization",
+	"Proxy-Authorization",
+	"Cookie",
+	"Set-Cookie",
+	"X-Api-Key",
+}
+
+// DefaultRedactedQueryParams are the query parameters whose values are never logged
+var DefaultRedactedQueryParams = []string{
+	"access_token",
+	"api_key",
+	"apikey",
+	"key",
+	"password",
+	"secret",
+	"signature",
+	"token",
+}
+
+type Option func(*RoundTripper)
+
+// WithHeaders logs the request and response headers
+func WithHeaders(enabled bool) Option {
+	return func(rt *RoundTripper) {
+		rt.logHeaders = enabled
+	}
+}
+
+// WithBodies logs up to maxBytes of the request and response bodies, 0 disables body capture
+func WithBodies(maxBytes int) Option {
+	return func(rt *RoundTripper) {
+		rt.maxBodyBytes = maxBytes
+	}
+}
+
+// WithRedactedHeaders replaces the headers whose values are redacted
+func WithRedactedHeaders(names ...string) Option {
+	return func(rt *RoundTripper) {
+		rt.redactedHeaders = make([]string, len(names))
+		for i, name := range names {
+			rt.redactedHeaders[i] = http.CanonicalHeaderKey(name)
+		}
+	}
+}
+
+// WithRedactedQueryParams replaces the query parameters whose values are redacted,
+// "*" redacts every value
+func WithRedactedQueryParams(names ...string) Option {
+	return func(rt *RoundTripper) {
+		rt.redactedQuery = names
+	}
+}
+
+// WithSampleRate logs only the given fraction (0, 1] of successful requests,
+// failed requests (transport errors and 5xx responses) are always logged
+func WithSampleRate(rate float64) Option {
+	return func(rt *RoundTripper) {
+		rt.sampleRate = rate
+	}
+}
+
+// RoundTripper logs every request through a slog.Handler with its method, redacted URL,
+// status, duration, sizes, retry attempt and error
+type RoundTripper struct {
+	logger *slog.Logger
+
+	logHeaders      bool
+	maxBodyBytes    int
+	redactedHeaders []string
+	redactedQuery   []string
+	sampleRate      float64
+
+	base http.RoundTripper
+}
+
+// NewRoundTripper creates a new structured logging RoundTripper.
+// If h is nil, the handler of slog.Default() is used.
+// If base is nil, http.DefaultTransport is used.
+func NewRoundTripper(h slog.Handler, base http.RoundTripper, opts ...Option) *RoundTripper {
+	if h == nil {
+		h = slog.Default().Handler()
+	}
+
+	if base == nil {
+		base = http.DefaultTransport
+	}
+
+	rt := &RoundTripper{
+		logger:          slog.New(h),
+		redactedHeaders: DefaultRedactedHeaders,
+		redactedQuery:   DefaultRedactedQueryParams,
+		sampleRate:      1,
+		base:            base,
+	}
+
+	for _, opt := range opts {
+		opt(rt)
+	}
+
+	if rt.sampleRate <= 0 || rt.sampleRate > 1 {
+		rt.sampleRate = 1
+	}
+
+	return rt
+}
+
+// Middleware returns a roundtripper.Middleware which wraps its base with a structured logging RoundTripper
+func Middleware(h slog.Handler, opts ...Option) func(http.RoundTripper) http.RoundTripper {
+	return func(base http.RoundTripper) http.RoundTripper {
+		return NewRoundTripper(h, base, opts...)
+	}
+}
+
+func (rt *RoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	sampled := rt.sampleRate >= 1 || rand.Float64() < rt.sampleRate
+
+	var reqBody *capture
+	if sampled && rt.maxBodyBytes > 0 && req.Body != nil && req.Body != http.NoBody {
+		// capture the body while the base RoundTripper reads it, on a clone to leave the caller's request alone
+		reqBody = &capture{max: rt.maxBodyBytes}
+		clone := req.Clone(req.Context())
+		clone.Body = &teeBody{ReadCloser: req.Body, capture: reqBody}
+		req = clone
+	}
+
+	start := time.Now()
+	resp, err := rt.base.RoundTrip(req)
+	duration := time.Since(start)
+
+	failed := err != nil || resp.StatusCode >= http.StatusInternalServerError
+	if !sampled && !failed {
+		return resp, err
+	}
+
+	attrs := []slog.Attr{
+		slog.String("method", req.Method),
+		slog.String("url", RedactURL(req.URL, rt.redactedQuery)),
+		slog.Duration("duration", duration),
+		slog.Int64("request_size", req.ContentLength),
+	}
+
+	if attempt, ok := retry.AttemptFromContext(req.Context()); ok {
+		attrs = append(attrs, slog.Int("attempt", attempt))
+	}
+
+	if rt.logHeaders {
+		attrs = append(attrs, slog.Any("request_headers", rt.redactHeaders(req.Header)))
+	}
+
+	if reqBody != nil {
+		attrs = append(attrs, slog.String("request_body", reqBody.String()))
+	}
+
+	level := slog.LevelInfo
+
+	if err != nil {
+		level = slog.LevelError
+		attrs = append(attrs, slog.Any("error", err))
+	} else {
+		if resp.StatusCode >= http.StatusInternalServerError {
+			level = slog.LevelError
+		} else if resp.StatusCode >= http.StatusBadRequest {
+			level = slog.LevelWarn
+		}
+
+		attrs = append(attrs,
+			slog.Int("status", resp.StatusCode),
+			slog.Int64("response_size", resp.ContentLength),
+		)
+
+		// the connection phases when a timing RoundTripper sits below
+		if t, ok := timing.FromResponse(resp); ok {
+			attrs = append(attrs, slog.Any("timings", t))
+		}
+
+		if rt.logHeaders {
+			attrs = append(attrs, slog.Any("response_headers", rt.redactHeaders(resp.Header)))
+		}
+
+		// the response body is captured while the caller reads it, so that streams aren't held up,
+		// and logged once it's closed. The body of a 101 Switching Protocols is the connection
+		if sampled && rt.maxBodyBytes > 0 && resp.Body != nil && resp.StatusCode != http.StatusSwitchingProtocols {
+			respBody := &capture{max: rt.maxBodyBytes}
+			ctx := req.Context()
+
+			resp.Body = &logBody{
+				teeBody: teeBody{ReadCloser: resp.Body, capture: respBody},
+				log: func() {
+					attrs = append(attrs, slog.String("response_body", respBody.String()))
+					rt.logger.LogAttrs(ctx, level, "http request", attrs...)
+				},
+			}
+
+			return resp, nil
+		}
+	}
+
+	rt.logger.LogAttrs(req.Context(), level, "http request", attrs...)
+
+	return resp, err
+}
+
+// RedactURL returns u without its password and with the values of the query parameters
+// names replaced, matched case-insensitively. "*" redacts every value
+func RedactURL(u *url.URL, names []string) string {
+	if u.RawQuery == "" {
+		return u.Redacted()
+	}
+
+	query := u.Query()
+	for name := range query {
+		if slices.Contains(names, "*") || slices.ContainsFunc(names, func(s string) bool {
+			return strings.EqualFold(s, name)
+		}) {
+			for i := range query[name] {
+				query[name][i] = redacted
+			}
+		}
+	}
+
+	clone := *u
+	clone.RawQuery = query.Encode()
+
+	return clone.Redacted()
+}
+
+// redactHeaders returns a copy of h with sensitive values replaced
+func (rt *RoundTripper) redactHeaders(h http.Header) http.Header {
+	clone := h.Clone()
+	for _, name := range rt.redactedHeaders {
+		if _, ok := clone[name]; ok {
+			clone[name] = []string{redacted}
+		}
+	}
+
+	return clone
+}
+
+// capture keeps the first max bytes written to it, it's safe for concurrent use
+// since transports may still read the request body after RoundTrip returns
+type capture struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+	max int
+}
+
+func (c *capture) Write(p []byte) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if room := c.max - c.buf.Len(); room > 0 {
+		c.buf.Write(p[:min(room, len(p))])
+	}
+
+	return len(p), nil
+}
+
+func (c *capture) String() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.buf.String()
+}
+
+// teeBody copies what is read from the request body into a capture
+type teeBody struct {
+	io.ReadCloser
+	capture *capture
+}
+
+func (t *teeBody) Read(p []byte) (int, error) {
+	n, err := t.ReadCloser.Read(p)
+	if n > 0 {
+		t.capture.Write(p[:n])
+	}
+
+	return n, err
+}
+
+// logBody captures a response body and logs the request once when it's closed
+type logBody struct {
+	teeBody
+	once sync.Once
+	log  func()
+}
+
+func (b *logBody) Close() error {
+	err := b.teeBody.Close()
+	b.once.Do(b.log)
+
+	return err
+}
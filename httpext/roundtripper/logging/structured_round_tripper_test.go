@@ -0,0 +1,145 @@
+package logging_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/tanveerprottoy/stdlib-ext/httpext/roundtripper"
+	"github.com/tanveerprottoy/stdlib-ext/httpext/roundtripper/logging"
+)
+
+func TestRoundTripper(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Set-Cookie", "session=secret")
+		io.WriteString(w, "hello from the server")
+	}))
+	defer srv.Close()
+
+	var out bytes.Buffer
+
+	rt := logging.NewRoundTripper(
+		slog.NewJSONHandler(&out, nil),
+		nil,
+		logging.WithHeaders(true),
+		logging.WithBodies(5),
+	)
+
+	req, _ := http.NewRequest(http.MethodPost, srv.URL+"/path?token=abc&page=2", strings.NewReader("request body"))
+	req.Header.Set("Authorization", "Bearer abc")
+
+	resp, err := rt.RoundTrip(req)
+	if err != nil {
+		t.Fatalf("RoundTrip error: %v", err)
+	}
+
+	// the captured bytes must be passed through
+	body, _ := io.ReadAll(resp.Body)
+	if string(body) != "hello from the server" {
+		t.Errorf("response body = %q", body)
+	}
+
+	if out.Len() != 0 {
+		t.Errorf("expected the request to be logged once the body is closed")
+	}
+
+	resp.Body.Close()
+
+	var entry map[string]any
+	if err := json.Unmarshal(out.Bytes(), &entry); err != nil {
+		t.Fatalf("invalid log entry %q: %v", out.String(), err)
+	}
+
+	if entry["method"] != http.MethodPost || entry["status"] != float64(http.StatusOK) {
+		t.Errorf("unexpected entry %v", entry)
+	}
+
+	if url := entry["url"].(string); strings.Contains(url, "abc") || !strings.Contains(url, "page=2") {
+		t.Errorf("expected the token to be redacted, got %s", url)
+	}
+
+	if strings.Contains(out.String(), "Bearer abc") || strings.Contains(out.String(), "session=secret") {
+		t.Errorf("expected sensitive headers to be redacted, got %s", out.String())
+	}
+
+	if entry["request_body"] != "reque" || entry["response_body"] != "hello" {
+		t.Errorf("unexpected captured bodies %v, %v", entry["request_body"], entry["response_body"])
+	}
+
+	if req.Header.Get("Authorization") != "Bearer abc" {
+		t.Errorf("the caller's request must not be mutated")
+	}
+}
+
+func TestResponseBodyIsNotPeeked(t *testing.T) {
+	// subtest testStreamingResponse
+	t.Run("testStreamingResponse", func(t *testing.T) {
+		release := make(chan struct{})
+
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.(http.Flusher).Flush()
+			<-release
+			io.WriteString(w, "event")
+		}))
+		defer srv.Close()
+		defer close(release)
+
+		rt := logging.NewRoundTripper(slog.NewJSONHandler(io.Discard, nil), nil, logging.WithBodies(1024))
+
+		req, _ := http.NewRequest(http.MethodGet, srv.URL, nil)
+
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+
+			resp, err := rt.RoundTrip(req)
+			if err != nil {
+				t.Errorf("RoundTrip error: %v", err)
+				return
+			}
+			resp.Body.Close()
+		}()
+
+		select {
+		case <-done:
+		case <-time.After(2 * time.Second):
+			t.Errorf("RoundTrip waited for the response body")
+		}
+	})
+
+	// subtest testSwitchingProtocols
+	t.Run("testSwitchingProtocols", func(t *testing.T) {
+		conn := &rwc{}
+
+		rt := logging.NewRoundTripper(slog.NewJSONHandler(io.Discard, nil), roundtripper.Func(func(req *http.Request) (*http.Response, error) {
+			return &http.Response{StatusCode: http.StatusSwitchingProtocols, Body: conn, Request: req}, nil
+		}), logging.WithBodies(1024))
+
+		req, _ := http.NewRequest(http.MethodGet, "http://example.com", nil)
+
+		resp, err := rt.RoundTrip(req)
+		if err != nil {
+			t.Fatalf("RoundTrip error: %v", err)
+		}
+		defer resp.Body.Close()
+
+		if _, ok := resp.Body.(io.Writer); !ok {
+			t.Errorf("expected the body of a 101 response to stay writable")
+		}
+	})
+}
+
+// rwc is the connection of a switched protocol
+type rwc struct {
+	bytes.Buffer
+}
+
+func (*rwc) Close() error {
+	return nil
+}
@@ -0,0 +1,281 @@
+package ratelimit
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/tanveerprottoy/stdlib-ext/httpext/backoff"
+	"github.com/tanveerprottoy/stdlib-ext/httpext/roundtripper/retry"
+)
+
+// ErrLimited is returned in fail-fast mode when no token is available
+var ErrLimited = errors.New("ratelimit: rate limit exceeded")
+
+// Mode decides what happens to a request when its bucket is empty
+type Mode int
+
+const (
+	ModeBlock    Mode = iota // wait for a token or until the request context is done
+	ModeFailFast             // return ErrLimited immediately
+)
+
+type Config struct {
+	Rate  float64 // tokens added per second
+	Burst int     // bucket capacity
+	Mode  Mode    // blocking or fail-fast
+}
+
+type Option func(*RoundTripper)
+
+// WithKeyFunc sets the function which maps a request to its bucket, the host by default
+func WithKeyFunc(f func(req *http.Request) string) Option {
+	return func(rt *RoundTripper) {
+		rt.keyFunc = f
+	}
+}
+
+// WithHeaderAdjustment makes the limiter follow the server's view of the quota,
+// the RateLimit-Remaining/RateLimit-Reset (or RateLimit) headers cap the available
+// tokens and a 429 with Retry-After pauses the bucket
+func WithHeaderAdjustment(enabled bool) Option {
+	return func(rt *RoundTripper) {
+		rt.adjust = enabled
+	}
+}
+
+// WithMaxPause sets the upper bound for pauses requested by the server through the
+// Retry-After and RateLimit-Reset headers, retry.DefaultMaxRetryAfter by default
+func WithMaxPause(d time.Duration) Option {
+	return func(rt *RoundTripper) {
+		rt.maxPause = d
+	}
+}
+
+// WithClock sets the clock used to refill buckets and wait for tokens
+func WithClock(c backoff.Clock) Option {
+	return func(rt *RoundTripper) {
+		rt.clock = c
+	}
+}
+
+// RoundTripper limits the rate of outgoing requests with a token bucket per key
+type RoundTripper struct {
+	cfg Config
+
+	keyFunc  func(req *http.Request) string
+	adjust   bool
+	maxPause time.Duration
+	clock    backoff.Clock
+
+	mu      sync.Mutex
+	buckets map[string]*bucket
+
+	base http.RoundTripper
+}
+
+// NewRoundTripper creates a new rate limiting RoundTripper.
+// If base is nil, http.DefaultTransport is used.
+func NewRoundTripper(cfg Config, base http.RoundTripper, opts ...Option) *RoundTripper {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+
+	// sanitize rate and burst
+	if cfg.Rate <= 0 {
+		cfg.Rate = 10
+	}
+
+	if cfg.Burst <= 0 {
+		cfg.Burst = 1
+	}
+
+	rt := &RoundTripper{
+		cfg:     cfg,
+		keyFunc: HostKey,
+		clock:   backoff.SystemClock(),
+		buckets: make(map[string]*bucket),
+		base:    base,
+	}
+
+	for _, opt := range opts {
+		opt(rt)
+	}
+
+	if rt.maxPause <= 0 {
+		rt.maxPause = retry.DefaultMaxRetryAfter
+	}
+
+	return rt
+}
+
+// Middleware returns a roundtripper.Middleware which wraps its base with a rate limiter
+func Middleware(cfg Config, opts ...Option) func(http.RoundTripper) http.RoundTripper {
+	return func(base http.RoundTripper) http.RoundTripper {
+		return NewRoundTripper(cfg, base, opts...)
+	}
+}
+
+// HostKey keys buckets by the request host
+func HostKey(req *http.Request) string {
+	return req.URL.Host
+}
+
+func (rt *RoundTripper) bucket(key string) *bucket {
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+
+	b, ok := rt.buckets[key]
+	if !ok {
+		b = &bucket{
+			rate:   rt.cfg.Rate,
+			burst:  float64(rt.cfg.Burst),
+			tokens: float64(rt.cfg.Burst),
+			last:   rt.clock.Now(),
+		}
+		rt.buckets[key] = b
+	}
+
+	return b
+}
+
+func (rt *RoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	key := rt.keyFunc(req)
+	b := rt.bucket(key)
+
+	if err := rt.wait(req, b); err != nil {
+		if req.Body != nil {
+			req.Body.Close()
+		}
+
+		return nil, fmt.Errorf("%w: %s", err, key)
+	}
+
+	resp, err := rt.base.RoundTrip(req)
+
+	if rt.adjust && resp != nil {
+		b.adjust(resp, rt.clock.Now(), rt.maxPause)
+	}
+
+	return resp, err
+}
+
+// wait takes a token from b, blocking until one is available in ModeBlock
+func (rt *RoundTripper) wait(req *http.Request, b *bucket) error {
+	d, ok := b.take(rt.clock.Now(), rt.cfg.Mode == ModeBlock)
+	if !ok {
+		return ErrLimited
+	}
+
+	if err := backoff.Sleep(req.Context(), rt.clock, d); err != nil {
+		// hand back the reserved token
+		b.cancel()
+		return err
+	}
+
+	return nil
+}
+
+// bucket is the token bucket of a single key
+type bucket struct {
+	mu sync.Mutex
+
+	rate   float64
+	burst  float64
+	tokens float64
+
+	// last is when tokens were last added, a pause requested by the server
+	// moves it to the end of the pause so that no tokens accrue before it
+	last time.Time
+}
+
+// refill adds the tokens accrued since the last refill
+func (b *bucket) refill(now time.Time) {
+	if elapsed := now.Sub(b.last); elapsed > 0 {
+		b.tokens = min(b.burst, b.tokens+elapsed.Seconds()*b.rate)
+		b.last = now
+	}
+}
+
+// take consumes a token and returns how long to wait for it. When reserve is false
+// and no token is available right away nothing is consumed and ok is false
+func (b *bucket) take(now time.Time, reserve bool) (time.Duration, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.refill(now)
+
+	// tokens accrue from the end of a pause, callers queued behind it are spaced by the rate
+	wait := max(b.last.Sub(now), 0)
+	if b.tokens < 1 {
+		wait += time.Duration((1 - b.tokens) / b.rate * float64(time.Second))
+	}
+
+	if wait > 0 && !reserve {
+		return wait, false
+	}
+
+	// the balance may go negative, later callers queue behind this reservation
+	b.tokens--
+
+	return wait, true
+}
+
+// cancel returns a reserved token that was not used
+func (b *bucket) cancel() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.tokens = min(b.burst, b.tokens+1)
+}
+
+// adjust applies the quota reported by the server, pausing the bucket for at most maxPause
+func (b *bucket) adjust(resp *http.Response, now time.Time, maxPause time.Duration) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.refill(now)
+
+	remaining, hasRemaining := parseRemaining(resp.Header)
+	reset, hasReset := retry.RetryAfter(resp, now)
+
+	if hasRemaining {
+		b.tokens = min(b.tokens, float64(remaining))
+	}
+
+	// the quota is exhausted, wait for it to be reset
+	exhausted := (hasRemaining && remaining == 0) || resp.StatusCode == http.StatusTooManyRequests
+	if exhausted && hasReset {
+		if until := now.Add(min(reset, maxPause)); until.After(b.last) {
+			// no tokens accrue during the pause, the first one is available when it ends
+			b.tokens = min(b.tokens, 0)
+			b.last = until.Add(-time.Duration(float64(time.Second) / b.rate))
+		}
+	}
+}
+
+// parseRemaining parses RateLimit-Remaining or the remaining parameter of the RateLimit header
+func parseRemaining(h http.Header) (int64, bool) {
+	if v := h.Get("RateLimit-Remaining"); v != "" {
+		n, err := strconv.ParseInt(strings.TrimSpace(v), 10, 64)
+		return n, err == nil && n >= 0
+	}
+
+	// RateLimit: limit=100, remaining=0, reset=30
+	// newer drafts name the remaining parameter r
+	for _, param := range strings.FieldsFunc(h.Get("RateLimit"), func(r rune) bool { return r == ',' || r == ';' }) {
+		key, val, found := strings.Cut(strings.TrimSpace(param), "=")
+		if !found || (key != "remaining" && key != "r") {
+			continue
+		}
+
+		n, err := strconv.ParseInt(strings.TrimSpace(val), 10, 64)
+		return n, err == nil && n >= 0
+	}
+
+	return 0, false
+}
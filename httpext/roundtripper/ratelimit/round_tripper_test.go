@@ -0,0 +1,246 @@
+package ratelimit_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/tanveerprottoy/stdlib-ext/httpext/internal/backofftest"
+	"github.com/tanveerprottoy/stdlib-ext/httpext/roundtripper"
+	"github.com/tanveerprottoy/stdlib-ext/httpext/roundtripper/ratelimit"
+)
+
+func ok(req *http.Request) (*http.Response, error) {
+	return &http.Response{StatusCode: http.StatusOK, Header: http.Header{}, Body: http.NoBody}, nil
+}
+
+func TestFailFast(t *testing.T) {
+	clock := backofftest.NewClock(time.Now())
+
+	rt := ratelimit.NewRoundTripper(
+		ratelimit.Config{Rate: 1, Burst: 2, Mode: ratelimit.ModeFailFast},
+		roundtripper.Func(ok),
+		ratelimit.WithClock(clock),
+	)
+
+	do := func(url string) error {
+		req, _ := http.NewRequest(http.MethodGet, url, nil)
+		_, err := rt.RoundTrip(req)
+		return err
+	}
+
+	for i := 0; i < 2; i++ {
+		if err := do("http://a.example.com"); err != nil {
+			t.Fatalf("request %d: unexpected error %v", i, err)
+		}
+	}
+
+	if err := do("http://a.example.com"); !errors.Is(err, ratelimit.ErrLimited) {
+		t.Errorf("expected ErrLimited, got %v", err)
+	}
+
+	// buckets are per host
+	if err := do("http://b.example.com"); err != nil {
+		t.Errorf("unexpected error for another host %v", err)
+	}
+
+	clock.Advance(time.Second)
+
+	if err := do("http://a.example.com"); err != nil {
+		t.Errorf("expected a refilled token, got %v", err)
+	}
+}
+
+func TestBlock(t *testing.T) {
+	clock := backofftest.NewClock(time.Now())
+
+	rt := ratelimit.NewRoundTripper(
+		ratelimit.Config{Rate: 2, Burst: 1},
+		roundtripper.Func(ok),
+		ratelimit.WithClock(clock),
+	)
+
+	start := clock.Now()
+
+	for i := 0; i < 3; i++ {
+		req, _ := http.NewRequest(http.MethodGet, "http://example.com", nil)
+		if _, err := rt.RoundTrip(req); err != nil {
+			t.Fatalf("request %d: unexpected error %v", i, err)
+		}
+	}
+
+	if waited := clock.Now().Sub(start); waited != time.Second {
+		t.Errorf("expected to wait 1s for 2 tokens at 2/s, waited %v", waited)
+	}
+
+	// a done context stops the wait
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, "http://example.com", nil)
+	if _, err := rt.RoundTrip(req); !errors.Is(err, context.Canceled) {
+		t.Errorf("expected context.Canceled, got %v", err)
+	}
+}
+
+func TestHeaderAdjustment(t *testing.T) {
+	clock := backofftest.NewClock(time.Now())
+
+	base := roundtripper.Func(func(req *http.Request) (*http.Response, error) {
+		h := http.Header{}
+		h.Set("RateLimit-Remaining", "0")
+		h.Set("RateLimit-Reset", "10")
+		return &http.Response{StatusCode: http.StatusOK, Header: h, Body: http.NoBody}, nil
+	})
+
+	rt := ratelimit.NewRoundTripper(
+		ratelimit.Config{Rate: 100, Burst: 100, Mode: ratelimit.ModeFailFast},
+		base,
+		ratelimit.WithClock(clock),
+		ratelimit.WithHeaderAdjustment(true),
+	)
+
+	do := func() error {
+		req, _ := http.NewRequest(http.MethodGet, "http://example.com", nil)
+		_, err := rt.RoundTrip(req)
+		return err
+	}
+
+	if err := do(); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	if err := do(); !errors.Is(err, ratelimit.ErrLimited) {
+		t.Errorf("expected the exhausted quota to limit, got %v", err)
+	}
+
+	clock.Advance(10 * time.Second)
+
+	if err := do(); err != nil {
+		t.Errorf("expected the quota to be reset, got %v", err)
+	}
+}
+
+func TestQueuedAcrossPause(t *testing.T) {
+	clock := backofftest.NewClock(time.Now())
+	clock.Manual = true
+
+	var (
+		mu   sync.Mutex
+		sent []time.Time
+	)
+
+	sentCount := func() int {
+		mu.Lock()
+		defer mu.Unlock()
+
+		return len(sent)
+	}
+
+	// the first request is answered with a 429, the queued ones succeed
+	base := roundtripper.Func(func(req *http.Request) (*http.Response, error) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		sent = append(sent, clock.Now())
+
+		if len(sent) == 1 {
+			h := http.Header{}
+			h.Set("Retry-After", "10")
+			return &http.Response{StatusCode: http.StatusTooManyRequests, Header: h, Body: http.NoBody}, nil
+		}
+
+		return ok(req)
+	})
+
+	rt := ratelimit.NewRoundTripper(
+		ratelimit.Config{Rate: 1, Burst: 1, Mode: ratelimit.ModeBlock},
+		base,
+		ratelimit.WithClock(clock),
+		ratelimit.WithHeaderAdjustment(true),
+	)
+
+	do := func() {
+		req, _ := http.NewRequest(http.MethodGet, "http://example.com", nil)
+		if _, err := rt.RoundTrip(req); err != nil {
+			t.Errorf("RoundTrip error: %v", err)
+		}
+	}
+
+	start := clock.Now()
+	do()
+
+	const queued = 3
+
+	var wg sync.WaitGroup
+	for range queued {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			do()
+		}()
+	}
+
+	// every request is either waiting for the clock or was sent
+	settled := func() {
+		deadline := time.Now().Add(5 * time.Second)
+		for sentCount()+clock.Waiters() != 1+queued && time.Now().Before(deadline) {
+			time.Sleep(time.Millisecond)
+		}
+	}
+
+	settled()
+
+	for range 15 {
+		clock.Advance(time.Second)
+		settled()
+	}
+
+	wg.Wait()
+
+	// the queued requests are released one per second after the pause, not all at once
+	for i, want := range []time.Duration{0, 10 * time.Second, 11 * time.Second, 12 * time.Second} {
+		if got := sent[i].Sub(start); got != want {
+			t.Errorf("request %d: expected to be sent after %v, got %v", i, want, got)
+		}
+	}
+}
+
+func TestMaxPause(t *testing.T) {
+	clock := backofftest.NewClock(time.Now())
+
+	base := roundtripper.Func(func(req *http.Request) (*http.Response, error) {
+		h := http.Header{}
+		h.Set("Retry-After", "86400")
+		return &http.Response{StatusCode: http.StatusTooManyRequests, Header: h, Body: http.NoBody}, nil
+	})
+
+	rt := ratelimit.NewRoundTripper(
+		ratelimit.Config{Rate: 100, Burst: 100, Mode: ratelimit.ModeFailFast},
+		base,
+		ratelimit.WithClock(clock),
+		ratelimit.WithHeaderAdjustment(true),
+		ratelimit.WithMaxPause(time.Minute),
+	)
+
+	do := func() error {
+		req, _ := http.NewRequest(http.MethodGet, "http://example.com", nil)
+		_, err := rt.RoundTrip(req)
+		return err
+	}
+
+	do()
+
+	if err := do(); !errors.Is(err, ratelimit.ErrLimited) {
+		t.Fatalf("expected the bucket to be paused, got %v", err)
+	}
+
+	clock.Advance(time.Minute)
+
+	if err := do(); err != nil {
+		t.Errorf("expected the pause to be capped at a minute, got %v", err)
+	}
+}
@@ -0,0 +1,317 @@
+package retry
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sync"
+)
+
+const (
+	// DefaultReplayMemoryLimit is the number of bytes of a non-rewindable body kept in memory
+	DefaultReplayMemoryLimit = 1 << 20 // 1 MiB
+
+	// DefaultReplayBodyLimit is the maximum size of a non-rewindable body that can be replayed
+	DefaultReplayBodyLimit = 64 << 20 // 64 MiB
+)
+
+// ErrBodyTooLarge is returned when a request body without GetBody is larger than the replay limit
+var ErrBodyTooLarge = errors.New("retry: request body exceeds the replay limit, set http.Request.GetBody to make it rewindable")
+
+// errBodyRewound is returned by the body of the first attempt once it was rewound for a replay
+var errBodyRewound = errors.New("retry: request body was rewound for another attempt")
+
+// BodyReplayer hands out a fresh copy of a request body to every attempt.
+// It prefers http.Request.GetBody, a non-rewindable body is streamed to the first
+// attempt and spooled on the way, first in memory and then in a temp file once
+// memoryLimit is exceeded. A body larger than bodyLimit is only sent once
+type BodyReplayer struct {
+	getBody func() (io.ReadCloser, error)
+	size    int64 // size of the spooled body, -1 when GetBody is used
+
+	// spool state of a body without GetBody
+	src         io.ReadCloser
+	memoryLimit int64
+	bodyLimit   int64
+	buf         bytes.Buffer
+	spooled     int64
+	spoolErr    error // why the body can't be replayed, e.g. ErrBodyTooLarge
+	streamed    bool  // the first attempt got the streaming body
+	inUse       bool  // the streaming body wasn't closed by the transport yet
+	rewound     bool  // the streaming body may no longer read src
+	eof         bool
+	srcClosed   bool
+
+	// file spool state, the file is removed once the replayer and every body it handed out are closed
+	mu     sync.Mutex
+	file   *os.File
+	refs   int
+	closed bool
+}
+
+// NewBodyReplayer prepares the body of req for replay. The body of a request
+// without GetBody is read while the first attempt is sent, see Rewind
+func NewBodyReplayer(req *http.Request, memoryLimit, bodyLimit int64) (*BodyReplayer, error) {
+	b := &BodyReplayer{size: -1}
+
+	if req.Body == nil || req.Body == http.NoBody {
+		return b, nil
+	}
+
+	if req.GetBody != nil {
+		// every attempt gets its own copy, the original body is never read
+		req.Body.Close()
+		b.getBody = req.GetBody
+		return b, nil
+	}
+
+	b.src = req.Body
+	b.memoryLimit = memoryLimit
+	b.bodyLimit = bodyLimit
+
+	return b, nil
+}
+
+// Rewind reads the rest of a body streamed to the first attempt into the spool so that it
+// can be replayed. It fails with ErrBodyTooLarge when the body is larger than bodyLimit
+func (b *BodyReplayer) Rewind() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.src == nil || b.getBody != nil {
+		return nil
+	}
+
+	// the first attempt is over, its body must not compete for src
+	b.rewound = true
+
+	chunk := make([]byte, 32<<10)
+
+	for !b.eof && b.spoolErr == nil {
+		n, err := b.src.Read(chunk)
+		b.spool(chunk[:n])
+
+		if err == io.EOF {
+			b.eof = true
+		} else if err != nil {
+			b.failSpool(err)
+		}
+	}
+
+	if b.spoolErr != nil {
+		return b.spoolErr
+	}
+
+	b.size = b.spooled
+
+	if b.file == nil {
+		data := b.buf.Bytes()
+		b.getBody = func() (io.ReadCloser, error) {
+			return io.NopCloser(bytes.NewReader(data)), nil
+		}
+	} else {
+		b.getBody = b.fileBody
+	}
+
+	return nil
+}
+
+// spool appends p to the memory buffer, or to the temp file once it exceeds memoryLimit
+func (b *BodyReplayer) spool(p []byte) {
+	if len(p) == 0 || b.spoolErr != nil {
+		return
+	}
+
+	b.spooled += int64(len(p))
+
+	if b.spooled > b.bodyLimit {
+		b.failSpool(fmt.Errorf("%w: more than %d bytes", ErrBodyTooLarge, b.bodyLimit))
+		return
+	}
+
+	if b.file == nil && b.spooled <= b.memoryLimit {
+		b.buf.Write(p)
+		return
+	}
+
+	if b.file == nil {
+		f, err := os.CreateTemp("", "httpext-body-*")
+		if err != nil {
+			b.failSpool(err)
+			return
+		}
+
+		b.file = f
+
+		// move the buffered prefix to the file
+		if _, err := b.buf.WriteTo(f); err != nil {
+			b.failSpool(err)
+			return
+		}
+	}
+
+	if _, err := b.file.Write(p); err != nil {
+		b.failSpool(err)
+	}
+}
+
+// failSpool gives up replaying the body and drops what was spooled
+func (b *BodyReplayer) failSpool(err error) {
+	b.spoolErr = err
+	b.buf = bytes.Buffer{}
+
+	if b.file != nil {
+		b.file.Close()
+		os.Remove(b.file.Name())
+		b.file = nil
+	}
+}
+
+func (b *BodyReplayer) fileBody() (io.ReadCloser, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.closed {
+		return nil, os.ErrClosed
+	}
+
+	b.refs++
+
+	return &fileBody{Reader: io.NewSectionReader(b.file, 0, b.size), release: b.release}, nil
+}
+
+// replay returns a fresh copy of the body, it's the GetBody of every attempt
+func (b *BodyReplayer) replay() (io.ReadCloser, error) {
+	if err := b.Rewind(); err != nil {
+		return nil, err
+	}
+
+	return b.getBody()
+}
+
+// release drops a reference to the spool file and removes it when unused
+func (b *BodyReplayer) release() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.refs--
+	b.removeIfUnused()
+}
+
+func (b *BodyReplayer) removeIfUnused() {
+	if b.closed && b.refs == 0 && b.file != nil {
+		b.file.Close()
+		os.Remove(b.file.Name())
+		b.file = nil
+	}
+}
+
+// closeSrc closes the original body once neither the replayer nor the first attempt need it
+func (b *BodyReplayer) closeSrc() {
+	if b.src != nil && b.closed && !b.inUse && !b.srcClosed {
+		b.srcClosed = true
+		b.src.Close()
+	}
+}
+
+// Prepare sets a fresh body on req, a clone of the original request. The first attempt of a
+// body without GetBody streams it, the later ones fail when it can't be rewound
+func (b *BodyReplayer) Prepare(req *http.Request) error {
+	if b.src != nil && !b.streamed {
+		b.streamed = true
+		b.inUse = true
+
+		// the ContentLength of the original request is kept
+		req.Body = &teeBody{b: b}
+		// lets http.Client follow 307/308 redirects
+		req.GetBody = b.replay
+
+		return nil
+	}
+
+	if b.src == nil && b.getBody == nil {
+		return nil
+	}
+
+	body, err := b.replay()
+	if err != nil {
+		return err
+	}
+
+	req.Body = body
+	// lets http.Client follow 307/308 redirects
+	req.GetBody = b.replay
+
+	if b.size >= 0 {
+		req.ContentLength = b.size
+	}
+
+	return nil
+}
+
+// Close releases the spool file once every body handed out has been closed
+func (b *BodyReplayer) Close() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.closed = true
+	b.closeSrc()
+	b.removeIfUnused()
+
+	return nil
+}
+
+// teeBody streams the original body to the first attempt and spools what it reads
+type teeBody struct {
+	b    *BodyReplayer
+	once sync.Once
+}
+
+func (t *teeBody) Read(p []byte) (int, error) {
+	b := t.b
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.rewound {
+		return 0, errBodyRewound
+	}
+
+	n, err := b.src.Read(p)
+	b.spool(p[:n])
+
+	if err == io.EOF {
+		b.eof = true
+	}
+
+	return n, err
+}
+
+func (t *teeBody) Close() error {
+	t.once.Do(func() {
+		b := t.b
+
+		b.mu.Lock()
+		defer b.mu.Unlock()
+
+		b.inUse = false
+		b.closeSrc()
+	})
+
+	return nil
+}
+
+// fileBody reads a spooled body and releases the spool file on Close
+type fileBody struct {
+	io.Reader
+	once    sync.Once
+	release func()
+}
+
+func (f *fileBody) Close() error {
+	f.once.Do(f.release)
+	return nil
+}
@@ -0,0 +1,110 @@
+package retry_test
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/tanveerprottoy/stdlib-ext/httpext/roundtripper/retry"
+)
+
+// onceReader hides the concrete reader type so http.NewRequest can't set GetBody
+type onceReader struct {
+	r io.Reader
+}
+
+func (o *onceReader) Read(p []byte) (int, error) {
+	return o.r.Read(p)
+}
+
+func TestBodyReplayer(t *testing.T) {
+	t.Parallel()
+
+	payload := strings.Repeat("a", 100)
+
+	tests := []struct {
+		name        string
+		body        io.Reader
+		memoryLimit int64
+		bodyLimit   int64
+		expErr      error
+	}{
+		{"get body", strings.NewReader(payload), 10, 10, nil},
+		{"memory", &onceReader{strings.NewReader(payload)}, 1000, 1000, nil},
+		{"temp file", &onceReader{strings.NewReader(payload)}, 10, 1000, nil},
+		{"exact body limit", &onceReader{strings.NewReader(payload)}, 10, 100, nil},
+		{"too large", &onceReader{strings.NewReader(payload)}, 10, 50, retry.ErrBodyTooLarge},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			req, _ := http.NewRequest(http.MethodPut, "http://example.com", tc.body)
+
+			replayer, err := retry.NewBodyReplayer(req, tc.memoryLimit, tc.bodyLimit)
+			if err != nil {
+				t.Fatalf("NewBodyReplayer() error = %v", err)
+			}
+			defer replayer.Close()
+
+			// every attempt must see the whole body, a body which is too large is only sent once
+			for i := 0; i < 3; i++ {
+				attemptReq := req.Clone(req.Context())
+
+				err := replayer.Prepare(attemptReq)
+				if i > 0 && tc.expErr != nil {
+					if !errors.Is(err, tc.expErr) {
+						t.Errorf("Prepare() error = %v; want %v", err, tc.expErr)
+					}
+					return
+				}
+
+				if err != nil {
+					t.Fatalf("Prepare() error = %v", err)
+				}
+
+				b, err := io.ReadAll(attemptReq.Body)
+				attemptReq.Body.Close()
+
+				if err != nil || string(b) != payload {
+					t.Errorf("attempt %d read %d bytes, err: %v", i, len(b), err)
+				}
+
+				// the first attempt keeps the ContentLength of the caller's request
+				if i > 0 && attemptReq.ContentLength != int64(len(payload)) {
+					t.Errorf("attempt %d ContentLength = %d; want %d", i, attemptReq.ContentLength, len(payload))
+				}
+			}
+		})
+	}
+}
+
+func TestBodyReplayerPartialRead(t *testing.T) {
+	payload := strings.Repeat("a", 100)
+
+	req, _ := http.NewRequest(http.MethodPut, "http://example.com", &onceReader{strings.NewReader(payload)})
+
+	replayer, _ := retry.NewBodyReplayer(req, 10, 1000)
+	defer replayer.Close()
+
+	// the first attempt fails after sending part of the body
+	first := req.Clone(req.Context())
+	replayer.Prepare(first)
+	io.ReadFull(first.Body, make([]byte, 30))
+	first.Body.Close()
+
+	second := req.Clone(req.Context())
+	if err := replayer.Prepare(second); err != nil {
+		t.Fatalf("Prepare() error = %v", err)
+	}
+	defer second.Body.Close()
+
+	if b, _ := io.ReadAll(second.Body); string(b) != payload {
+		t.Errorf("expected the whole body on the second attempt, got %d bytes", len(b))
+	}
+
+	if _, err := first.Body.Read(make([]byte, 1)); err == nil {
+		t.Errorf("expected the first attempt's body to stop reading once it was rewound")
+	}
+}
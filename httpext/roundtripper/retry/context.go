@@ -0,0 +1,17 @@
+package retry
+
+import "context"
+
+type attemptKey struct{}
+
+// ContextWithAttempt returns a copy of ctx carrying the attempt number (0 based)
+func ContextWithAttempt(ctx context.Context, attempt int) context.Context {
+	return context.WithValue(ctx, attemptKey{}, attempt)
+}
+
+// AttemptFromContext returns the attempt number set by the retry loop, ok is false
+// when the request is not sent by a retry loop
+func AttemptFromContext(ctx context.Context) (int, bool) {
+	attempt, ok := ctx.Value(attemptKey{}).(int)
+	return attempt, ok
+}
@@ -0,0 +1,35 @@
+package retry
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrMaxElapsedTime is the cause of an Error when the next attempt would exceed the retry budget
+var ErrMaxElapsedTime = errors.New("retry: maximum elapsed time exceeded")
+
+// Error is returned when retrying stopped early, because the request context was done,
+// the maximum elapsed time was exhausted or the request body couldn't be replayed.
+// errors.Is matches both the cause and the error of the last attempt
+type Error struct {
+	Attempts   int   // number of attempts made
+	StatusCode int   // status code of the last attempt's response, 0 if there was none
+	Err        error // error returned by the last attempt, nil if it returned a response
+	Cause      error // context error, ErrMaxElapsedTime or ErrBodyTooLarge
+}
+
+func (e *Error) Error() string {
+	if e.Err != nil {
+		return fmt.Sprintf("retry: giving up after %d attempts: %v: %v", e.Attempts, e.Cause, e.Err)
+	}
+
+	return fmt.Sprintf("retry: giving up after %d attempts: %v: last status %d", e.Attempts, e.Cause, e.StatusCode)
+}
+
+func (e *Error) Unwrap() []error {
+	if e.Err == nil {
+		return []error{e.Cause}
+	}
+
+	return []error{e.Cause, e.Err}
+}
@@ -0,0 +1,186 @@
+package retry
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/tanveerprottoy/stdlib-ext/httpext/backoff"
+	"github.com/tanveerprottoy/stdlib-ext/httpext/metrics"
+)
+
+// Executor runs the attempts of a request, it is the retry loop shared by
+// RoundTripper and httpext's customClient. Call Sanitize before the first Do
+type Executor struct {
+	MaxRetries     int
+	Policy         Policy
+	Backoff        backoff.Strategy
+	Clock          backoff.Clock
+	MaxRetryAfter  time.Duration // upper bound for delays requested by the server
+	MaxElapsedTime time.Duration // total time budget for all attempts, 0 means no limit
+	IdempotencyKey bool          // retry non-idempotent requests with a generated Idempotency-Key
+
+	ReplayMemoryLimit int64 // bytes of a body without GetBody kept in memory
+	ReplayBodyLimit   int64 // maximum size of a body without GetBody that can be retried, larger bodies are sent once
+
+	Logger  *slog.Logger
+	Metrics metrics.Metrics
+}
+
+// Sanitize replaces unset fields with their defaults,
+// the default backoff adds a jitter of up to maxJitter
+func (e *Executor) Sanitize(maxJitter time.Duration) {
+	if e.MaxRetries < 0 {
+		e.MaxRetries = 0
+	}
+
+	if e.MaxRetryAfter <= 0 {
+		e.MaxRetryAfter = DefaultMaxRetryAfter
+	}
+
+	if e.ReplayMemoryLimit <= 0 {
+		e.ReplayMemoryLimit = DefaultReplayMemoryLimit
+	}
+
+	if e.ReplayBodyLimit <= 0 {
+		e.ReplayBodyLimit = max(DefaultReplayBodyLimit, e.ReplayMemoryLimit)
+	}
+
+	// a body limit below the memory limit caps both
+	if e.ReplayBodyLimit < e.ReplayMemoryLimit {
+		e.ReplayMemoryLimit = e.ReplayBodyLimit
+	}
+
+	if e.Policy == nil {
+		e.Policy = DefaultPolicy()
+	}
+
+	if e.Backoff == nil {
+		e.Backoff = DefaultBackoff(maxJitter)
+	}
+
+	if e.Clock == nil {
+		e.Clock = backoff.SystemClock()
+	}
+
+	if e.Logger == nil {
+		e.Logger = slog.Default()
+	}
+
+	if e.Metrics == nil {
+		e.Metrics = metrics.Noop()
+	}
+}
+
+// Do sends req with send until it succeeds, the policy gives up or the retries are exhausted.
+// Every attempt gets a clone of req with a fresh body and the attempt number in its context
+func (e *Executor) Do(req *http.Request, send func(*http.Request) (*http.Response, error)) (*http.Response, error) {
+	if e.MaxRetries == 0 {
+		return send(req)
+	}
+
+	// non-idempotent requests are only retried when they carry an Idempotency-Key
+	req, retryable, err := EnsureIdempotent(req, e.IdempotencyKey)
+	if err != nil {
+		return nil, err
+	}
+
+	if !retryable {
+		return send(req)
+	}
+
+	// reusing a request body can be a bit tricky because the
+	// io.ReadCloser interface, which is the type of r.Body in an
+	// http.Request, is designed for single consumption. Once you've read the body, the underlying reader is often at its end, and attempting to read it again will yield an empty result or an error.
+	// The replayer hands a fresh body to every attempt, the first one streams it.
+	body, err := NewBodyReplayer(req, e.ReplayMemoryLimit, e.ReplayBodyLimit)
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+
+	var (
+		resp  *http.Response
+		wait  time.Duration
+		start = e.Clock.Now()
+	)
+
+	for attempt := 0; ; attempt++ {
+		// the sender must not see the caller's request mutated
+		attemptReq := req.Clone(ContextWithAttempt(req.Context(), attempt))
+		if err := body.Prepare(attemptReq); err != nil {
+			return nil, err
+		}
+
+		resp, err = send(attemptReq)
+
+		// the context ended during a retry, the policy won't retry and the caller learns how
+		// many attempts were made. A response which wouldn't have been retried is still returned
+		if ctxErr := attemptReq.Context().Err(); ctxErr != nil && attempt > 0 && (err != nil || e.retryable(attemptReq, resp)) {
+			drainBody(resp)
+			return nil, &Error{Attempts: attempt + 1, StatusCode: statusCode(resp), Err: err, Cause: ctxErr}
+		}
+
+		if attempt >= e.MaxRetries || !e.Policy.ShouldRetry(attemptReq, resp, err) {
+			return resp, err
+		}
+
+		// a body which is too large to be replayed was sent once
+		if rewindErr := body.Rewind(); rewindErr != nil {
+			drainBody(resp)
+			return nil, &Error{Attempts: attempt + 1, StatusCode: statusCode(resp), Err: err, Cause: rewindErr}
+		}
+
+		// Retry-After/RateLimit-Reset headers take precedence over the backoff
+		wait = Delay(resp, e.Clock.Now(), e.Backoff.Backoff(attempt, wait), e.MaxRetryAfter)
+
+		e.Logger.LogAttrs(
+			req.Context(), slog.LevelInfo, "retry: retrying request",
+			slog.String("method", req.Method),
+			slog.String("host", req.URL.Host),
+			slog.Int("attempt", attempt),
+			slog.Duration("wait", wait),
+			slog.Int("status", statusCode(resp)),
+			slog.Any("error", err),
+		)
+
+		// drain the response body to reuse the connection
+		drainBody(resp)
+
+		// give up when the next attempt would start after the retry budget
+		if e.MaxElapsedTime > 0 && e.Clock.Now().Add(wait).Sub(start) > e.MaxElapsedTime {
+			return nil, &Error{Attempts: attempt + 1, StatusCode: statusCode(resp), Err: err, Cause: ErrMaxElapsedTime}
+		}
+
+		// wait for backoff time or until the request context is done
+		if ctxErr := backoff.Sleep(req.Context(), e.Clock, wait); ctxErr != nil {
+			return nil, &Error{Attempts: attempt + 1, StatusCode: statusCode(resp), Err: err, Cause: ctxErr}
+		}
+
+		e.Metrics.Retried(req.URL.Host, req.Method, attempt+1)
+	}
+}
+
+// retryable reports whether the policy would retry resp if the context of req hadn't ended
+func (e *Executor) retryable(req *http.Request, resp *http.Response) bool {
+	return e.Policy.ShouldRetry(req.WithContext(context.WithoutCancel(req.Context())), resp, nil)
+}
+
+// drainBody reads and closes the response body so that the connection can be reused
+func drainBody(resp *http.Response) {
+	if resp != nil && resp.Body != nil {
+		io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+	}
+}
+
+// statusCode returns the status code of resp or 0 when resp is nil
+func statusCode(resp *http.Response) int {
+	if resp == nil {
+		return 0
+	}
+
+	return resp.StatusCode
+}
@@ -0,0 +1,66 @@
+package retry
+
+import (
+	"crypto/rand"
+	"fmt"
+	"net/http"
+)
+
+// IdempotencyKeyHeader is the header carrying the key which lets the server
+// deduplicate retried non-idempotent requests
+const IdempotencyKeyHeader = "Idempotency-Key"
+
+// IsIdempotent reports whether req can be retried without side effects, i.e. its method
+// is idempotent (GET, HEAD, PUT, DELETE, OPTIONS) or it carries an Idempotency-Key header
+func IsIdempotent(req *http.Request) bool {
+	return IsIdempotentMethod(req.Method) || req.Header.Get(IdempotencyKeyHeader) != ""
+}
+
+// IsIdempotentMethod reports whether method is idempotent (GET, HEAD, PUT, DELETE, OPTIONS),
+// "" means GET
+func IsIdempotentMethod(method string) bool {
+	switch method {
+	case "", http.MethodGet, http.MethodHead, http.MethodPut, http.MethodDelete, http.MethodOptions:
+		return true
+	}
+
+	return false
+}
+
+// NewIdempotencyKey generates a random (version 4) UUID to be used as an Idempotency-Key
+func NewIdempotencyKey() (string, error) {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return "", err
+	}
+
+	b[6] = (b[6] & 0x0f) | 0x40 // version 4
+	b[8] = (b[8] & 0x3f) | 0x80 // variant 10
+
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:]), nil
+}
+
+// EnsureIdempotent reports whether req may be retried. When addKey is true a
+// non-idempotent request gets an Idempotency-Key header, which makes it retryable.
+// The header is set on a clone so the caller's request is never mutated, the same
+// key must then be sent with every attempt of the logical request
+func EnsureIdempotent(req *http.Request, addKey bool) (*http.Request, bool, error) {
+	if IsIdempotent(req) {
+		return req, true, nil
+	}
+
+	if !addKey {
+		return req, false, nil
+	}
+
+	key, err := NewIdempotencyKey()
+	if err != nil {
+		return nil, false, err
+	}
+
+	// shallow clone which shares the body with req
+	clone := req.Clone(req.Context())
+	clone.Header.Set(IdempotencyKeyHeader, key)
+
+	return clone, true, nil
+}
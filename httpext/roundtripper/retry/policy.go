@@ -0,0 +1,139 @@
+package retry
+
+import (
+	"context"
+	"crypto/x509"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"syscall"
+)
+
+// DefaultStatusCodes are the response status codes that are retried by the DefaultPolicy
+var DefaultStatusCodes = []int{
+	http.StatusRequestTimeout,
+	http.StatusTooManyRequests,
+	http.StatusBadGateway,
+	http.StatusServiceUnavailable,
+	http.StatusGatewayTimeout,
+}
+
+// Policy classifies the outcome of a single attempt and decides whether
+// the request should be attempted again. It is shared by the retry
+// RoundTripper and httpext's customClient
+type Policy interface {
+	// ShouldRetry reports whether the request should be retried, given the
+	// response and error returned by the last attempt. Either resp or err may be nil
+	ShouldRetry(req *http.Request, resp *http.Response, err error) bool
+}
+
+// PolicyFunc is an adapter to allow the use of ordinary functions as a Policy
+type PolicyFunc func(req *http.Request, resp *http.Response, err error) bool
+
+// ShouldRetry calls f(req, resp, err)
+func (f PolicyFunc) ShouldRetry(req *http.Request, resp *http.Response, err error) bool {
+	return f(req, resp, err)
+}
+
+// StatusPolicy retries transient transport errors and responses whose status code
+// is one of StatusCodes. Error responses carrying a Retry-After header are retried as well
+type StatusPolicy struct {
+	StatusCodes []int // retryable status codes, DefaultStatusCodes is used when empty
+}
+
+// DefaultPolicy returns the policy used when none is configured
+func DefaultPolicy() Policy {
+	return &StatusPolicy{StatusCodes: DefaultStatusCodes}
+}
+
+// ShouldRetry implements the Policy interface
+func (p *StatusPolicy) ShouldRetry(req *http.Request, resp *http.Response, err error) bool {
+	if req != nil && req.Context().Err() != nil {
+		// the caller is no longer waiting for the result
+		return false
+	}
+
+	if err != nil {
+		return IsRetryableError(err)
+	}
+
+	if resp == nil {
+		return false
+	}
+
+	return p.isRetryableResponse(resp)
+}
+
+func (p *StatusPolicy) isRetryableResponse(resp *http.Response) bool {
+	codes := p.StatusCodes
+	if len(codes) == 0 {
+		codes = DefaultStatusCodes
+	}
+
+	if slices.Contains(codes, resp.StatusCode) {
+		return true
+	}
+
+	// the server explicitly asked us to come back later
+	return resp.StatusCode >= http.StatusBadRequest && resp.Header.Get("Retry-After") != ""
+}
+
+// IsRetryableError reports whether err is a transient transport error,
+// e.g. connection refused/reset, timeouts or an unexpected EOF
+func IsRetryableError(err error) bool {
+	if err == nil {
+		return false
+	}
+
+	// the request context was cancelled or has expired
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+
+	// certificate problems won't fix themselves
+	var (
+		unknownAuthorityErr x509.UnknownAuthorityError
+		hostnameErr         x509.HostnameError
+		certInvalidErr      x509.CertificateInvalidError
+	)
+	if errors.As(err, &unknownAuthorityErr) || errors.As(err, &hostnameErr) || errors.As(err, &certInvalidErr) {
+		return false
+	}
+
+	var urlErr *url.Error
+	if errors.As(err, &urlErr) {
+		// errors returned by http.Client for malformed requests
+		if strings.Contains(urlErr.Error(), "unsupported protocol scheme") ||
+			strings.Contains(urlErr.Error(), "stopped after") {
+			return false
+		}
+	}
+
+	if errors.Is(err, syscall.ECONNREFUSED) ||
+		errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, syscall.ECONNABORTED) ||
+		errors.Is(err, syscall.EPIPE) {
+		return true
+	}
+
+	// the server closed the connection before sending a response
+	if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return true
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return true
+	}
+
+	// kept for errors that still implement the deprecated Temporary method
+	if errTemp, ok := err.(interface{ Temporary() bool }); ok && errTemp.Temporary() {
+		return true
+	}
+
+	return false
+}
@@ -0,0 +1,54 @@
+package retry_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+	"syscall"
+	"testing"
+
+	"github.com/tanveerprottoy/stdlib-ext/httpext/roundtripper/retry"
+)
+
+func TestStatusPolicyShouldRetry(t *testing.T) {
+	t.Parallel()
+
+	req, _ := http.NewRequest(http.MethodGet, "http://example.com", nil)
+
+	withHeader := func(code int, k, v string) *http.Response {
+		h := http.Header{}
+		h.Set(k, v)
+		return &http.Response{StatusCode: code, Header: h}
+	}
+
+	tests := []struct {
+		name string
+		resp *http.Response
+		err  error
+		exp  bool
+	}{
+		{"200", &http.Response{StatusCode: http.StatusOK}, nil, false},
+		{"404", &http.Response{StatusCode: http.StatusNotFound}, nil, false},
+		{"429", &http.Response{StatusCode: http.StatusTooManyRequests}, nil, true},
+		{"502", &http.Response{StatusCode: http.StatusBadGateway}, nil, true},
+		{"503", &http.Response{StatusCode: http.StatusServiceUnavailable}, nil, true},
+		{"504", &http.Response{StatusCode: http.StatusGatewayTimeout}, nil, true},
+		{"500 with Retry-After", withHeader(http.StatusInternalServerError, "Retry-After", "1"), nil, true},
+		{"connection refused", nil, &url.Error{Op: "Get", URL: "http://example.com", Err: syscall.ECONNREFUSED}, true},
+		{"connection reset", nil, syscall.ECONNRESET, true},
+		{"context canceled", nil, context.Canceled, false},
+		{"other error", nil, errors.New("boom"), false},
+	}
+
+	p := retry.DefaultPolicy()
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			actual := p.ShouldRetry(req, tc.resp, tc.err)
+			if actual != tc.exp {
+				t.Errorf("ShouldRetry() = %v; want %v", actual, tc.exp)
+			}
+		})
+	}
+}
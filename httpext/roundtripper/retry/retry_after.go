@@ -0,0 +1,96 @@
+package retry
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultMaxRetryAfter is the upper bound applied to server provided delays
+// when no maximum is configured
+const DefaultMaxRetryAfter = 60 * time.Second
+
+// RetryAfter returns the delay the server asked for through the Retry-After header
+// (delay-seconds or HTTP-date) or the IETF RateLimit-Reset/RateLimit headers of resp.
+// ok is false when resp carries no usable hint
+func RetryAfter(resp *http.Response, now time.Time) (time.Duration, bool) {
+	if resp == nil {
+		return 0, false
+	}
+
+	if v := resp.Header.Get("Retry-After"); v != "" {
+		if d, ok := parseRetryAfter(v, now); ok {
+			return d, true
+		}
+	}
+
+	// RateLimit-Reset: 30
+	if v := resp.Header.Get("RateLimit-Reset"); v != "" {
+		if d, ok := parseSeconds(v); ok {
+			return d, true
+		}
+	}
+
+	// RateLimit: limit=100, remaining=0, reset=30
+	// newer drafts name the reset parameter t
+	if v := resp.Header.Get("RateLimit"); v != "" {
+		for _, param := range strings.FieldsFunc(v, func(r rune) bool { return r == ',' || r == ';' }) {
+			key, val, found := strings.Cut(strings.TrimSpace(param), "=")
+			if !found || (key != "reset" && key != "t") {
+				continue
+			}
+
+			if d, ok := parseSeconds(val); ok {
+				return d, true
+			}
+		}
+	}
+
+	return 0, false
+}
+
+// parseRetryAfter parses a Retry-After value which is either a number of seconds or an HTTP-date
+func parseRetryAfter(v string, now time.Time) (time.Duration, bool) {
+	if d, ok := parseSeconds(v); ok {
+		return d, true
+	}
+
+	t, err := http.ParseTime(strings.TrimSpace(v))
+	if err != nil {
+		return 0, false
+	}
+
+	d := t.Sub(now)
+	if d < 0 {
+		d = 0
+	}
+
+	return d, true
+}
+
+// parseSeconds parses a non-negative number of seconds
+func parseSeconds(v string) (time.Duration, bool) {
+	secs, err := strconv.ParseInt(strings.TrimSpace(v), 10, 64)
+	if err != nil || secs < 0 {
+		return 0, false
+	}
+
+	if secs > int64(math.MaxInt64/time.Second) {
+		return time.Duration(math.MaxInt64), true
+	}
+
+	return time.Duration(secs) * time.Second, true
+}
+
+// Delay returns the wait before the next attempt, a server provided
+// delay bounded by max overrides the computed backoff
+func Delay(resp *http.Response, now time.Time, backoff, max time.Duration) time.Duration {
+	d, ok := RetryAfter(resp, now)
+	if !ok {
+		return backoff
+	}
+
+	return min(d, max)
+}
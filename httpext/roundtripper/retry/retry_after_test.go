@@ -0,0 +1,54 @@
+package retry_test
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/tanveerprottoy/stdlib-ext/httpext/roundtripper/retry"
+)
+
+func TestRetryAfter(t *testing.T) {
+	t.Parallel()
+
+	now := time.Date(2024, time.January, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name   string
+		header http.Header
+		exp    time.Duration
+		expOk  bool
+	}{
+		{"no header", http.Header{}, 0, false},
+		{"seconds", http.Header{"Retry-After": {"7"}}, 7 * time.Second, true},
+		{"http date", http.Header{"Retry-After": {now.Add(30 * time.Second).Format(http.TimeFormat)}}, 30 * time.Second, true},
+		{"date in the past", http.Header{"Retry-After": {now.Add(-time.Minute).Format(http.TimeFormat)}}, 0, true},
+		{"invalid", http.Header{"Retry-After": {"soon"}}, 0, false},
+		{"ratelimit reset", http.Header{"Ratelimit-Reset": {"12"}}, 12 * time.Second, true},
+		{"ratelimit structured", http.Header{"Ratelimit": {"limit=100, remaining=0, reset=5"}}, 5 * time.Second, true},
+		{"retry-after wins", http.Header{"Retry-After": {"3"}, "Ratelimit-Reset": {"12"}}, 3 * time.Second, true},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			resp := &http.Response{StatusCode: http.StatusTooManyRequests, Header: tc.header}
+
+			actual, ok := retry.RetryAfter(resp, now)
+			if ok != tc.expOk || actual != tc.exp {
+				t.Errorf("RetryAfter() = %v, %v; want %v, %v", actual, ok, tc.exp, tc.expOk)
+			}
+		})
+	}
+}
+
+func TestDelayIsBounded(t *testing.T) {
+	resp := &http.Response{Header: http.Header{"Retry-After": {"3600"}}}
+
+	if actual := retry.Delay(resp, time.Now(), time.Second, 10*time.Second); actual != 10*time.Second {
+		t.Errorf("Delay() = %v; want %v", actual, 10*time.Second)
+	}
+
+	if actual := retry.Delay(&http.Response{Header: http.Header{}}, time.Now(), time.Second, 10*time.Second); actual != time.Second {
+		t.Errorf("Delay() = %v; want %v", actual, time.Second)
+	}
+}
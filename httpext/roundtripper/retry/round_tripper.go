@@ -1,141 +1,163 @@
 package retry
 
 import (
-	"bytes"
-	"io"
-	"log"
-	"math"
-	"math/rand"
+	"log/slog"
 	"net/http"
+	"slices"
 	"time"
+
+	"github.com/tanveerprottoy/stdlib-ext/httpext/backoff"
+	"github.com/tanveerprottoy/stdlib-ext/httpext/metrics"
 )
 
-// RoundTripper is a custom HTTP round tripper that implements the http.RoundTripper interface
-// Roundtripper should be used when you want to add the retry logic in the http client's
-// Transport/Roundtripper level, instead of the client level
-type RoundTripper struct {
-	maxRetries int
-	maxJitter  int
+// DefaultMaxBackoff is the cap of the default exponential backoff
+const DefaultMaxBackoff = 30 * time.Second
 
-	base http.RoundTripper
+// DefaultBackoff returns the strategy used when none is configured,
+// 2^n seconds capped at DefaultMaxBackoff plus a random jitter in [0, maxJitter)
+func DefaultBackoff(maxJitter time.Duration) backoff.Strategy {
+	return backoff.WithJitter(backoff.NewExponential(time.Second, DefaultMaxBackoff), maxJitter, nil)
 }
 
-func NewRoundTripper(maxRetries, maxIdleConnsPerHost int, idleConnTimeout time.Duration) *RoundTripper {
-	return &RoundTripper{
-		maxRetries: maxRetries,
-		base: &http.Transport{
-			MaxIdleConnsPerHost: maxIdleConnsPerHost,
-			IdleConnTimeout:     idleConnTimeout,
-		},
+type Option func(*RoundTripper)
+
+// WithPolicy sets the policy which decides whether an attempt is retried
+func WithPolicy(p Policy) Option {
+	return func(r *RoundTripper) {
+		r.exec.Policy = p
 	}
 }
 
-// backoff generates the backoff time in seconds based on the number of retries
-func (r *RoundTripper) backoff(retries int) time.Duration {
-	// 2^n backoff, n = number of retries
-	return time.Duration(math.Pow(2, float64(retries))) * time.Second
+// WithMaxRetryAfter sets the upper bound for delays requested by the server
+// through the Retry-After and RateLimit-Reset headers
+func WithMaxRetryAfter(d time.Duration) Option {
+	return func(r *RoundTripper) {
+		r.exec.MaxRetryAfter = d
+	}
 }
 
-// jitter generates a random jitter in milliseconds which is added to the backoff time
-func (r *RoundTripper) jitter(max, attempts int) time.Duration {
-	rnd := rand.Intn(max)
-
-	return time.Duration(int(attempts*rnd)) * time.Millisecond
+// WithBackoff sets the strategy which computes the delay between attempts
+func WithBackoff(s backoff.Strategy) Option {
+	return func(r *RoundTripper) {
+		r.exec.Backoff = s
+	}
 }
 
-func (r *RoundTripper) restoreRequestBody(req *http.Request) error {
-	if req.Body == nil {
-		return nil
+// WithMaxElapsedTime sets the total time budget for all attempts of a request,
+// 0 means no limit
+func WithMaxElapsedTime(d time.Duration) Option {
+	return func(r *RoundTripper) {
+		r.exec.MaxElapsedTime = d
 	}
+}
 
-	// Read the body into a buffer
-	buf, err := io.ReadAll(req.Body)
-	if err != nil {
-		return err
+// WithIdempotencyKey makes non-idempotent requests (e.g. POST, PATCH) retryable by
+// attaching a generated Idempotency-Key header which is stable across attempts.
+// Without it only idempotent requests are retried
+func WithIdempotencyKey(enabled bool) Option {
+	return func(r *RoundTripper) {
+		r.exec.IdempotencyKey = enabled
 	}
+}
 
-	// Restore the body so it can be read again
-	// This is important because the body is an io.ReadCloser and can only be read once
-	req.Body = io.NopCloser(bytes.NewBuffer(buf))
+// WithReplayLimits sets how a request body without GetBody is buffered for replay while
+// the first attempt sends it, up to memoryLimit bytes are kept in memory, larger bodies up
+// to bodyLimit bytes are spooled to a temp file. Anything larger is sent once, a retry then
+// fails with ErrBodyTooLarge
+func WithReplayLimits(memoryLimit, bodyLimit int64) Option {
+	return func(r *RoundTripper) {
+		r.exec.ReplayMemoryLimit = memoryLimit
+		r.exec.ReplayBodyLimit = bodyLimit
+	}
+}
 
-	return nil
+// WithLogger sets the logger used to report retries, slog.Default() by default
+func WithLogger(l *slog.Logger) Option {
+	return func(r *RoundTripper) {
+		r.exec.Logger = l
+	}
 }
 
-func (r *RoundTripper) isRetryableError(err error) bool {
-	if err == nil {
-		return false
+// WithMetrics reports every retried attempt to m
+func WithMetrics(m metrics.Metrics) Option {
+	return func(r *RoundTripper) {
+		r.exec.Metrics = m
 	}
+}
 
-	// check if error is temporary
-	if errNet, ok := err.(interface{ Temporary() bool }); ok && errNet.Temporary() {
-		return true
+// WithClock sets the clock used to wait between attempts
+func WithClock(c backoff.Clock) Option {
+	return func(r *RoundTripper) {
+		r.exec.Clock = c
 	}
+}
 
-	return false
+// WithBase sets the RoundTripper used to make the attempts, it replaces
+// the http.Transport built from maxIdleConnsPerHost and idleConnTimeout
+func WithBase(base http.RoundTripper) Option {
+	return func(r *RoundTripper) {
+		r.base = base
+	}
 }
 
-func (r *RoundTripper) drainBody(resp *http.Response) {
-	// drain the response body to reuse the connection
-	// only do this if the response is not nil and the body is not nil
-	if resp != nil && resp.Body != nil {
-		io.Copy(io.Discard, resp.Body)
-		resp.Body.Close()
+// WithMaxJitter sets the maximum jitter in milliseconds,
+// it is ignored when a backoff strategy is set with WithBackoff
+func WithMaxJitter(maxJitter int) Option {
+	return func(r *RoundTripper) {
+		r.maxJitter = maxJitter
 	}
 }
 
-func (r *RoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
-	log.Println("RoundTripper: RoundTrip called")
-
-	var (
-		attempts = 0
-		resp     *http.Response
-		err      error
-	)
-
-	for attempts < r.maxRetries {
-		log.Printf("customClient: doWithRetry called, attempt %d\n", attempts)
-
-		// reusing a request body can be a bit tricky because the
-		// io.ReadCloser interface, which is the type of r.Body in an
-		// http.Request, is designed for single consumption. Once you've read the body, the underlying reader is often at its end, and attempting to read it again will yield an empty result or an error.
-		// Always rewind/restore the request body when non-nil.
-		if req.Body != nil {
-			if err := r.restoreRequestBody(req); err != nil {
-				return nil, err
-			}
-		}
+// RoundTripper is a custom HTTP round tripper that implements the http.RoundTripper interface
+// Roundtripper should be used when you want to add the retry logic in the http client's
+// Transport/Roundtripper level, instead of the client level
+type RoundTripper struct {
+	maxJitter int
+	exec      Executor
 
-		// use the base RoundTripper to make the request
-		resp, err = r.base.RoundTrip(req)
+	base http.RoundTripper
+}
 
-		log.Printf("customClient: doWithRetry.httpClient.Do called, attempt %d, response: %v\nerr: %v\n", attempts, resp, err)
+func NewRoundTripper(maxRetries, maxIdleConnsPerHost int, idleConnTimeout time.Duration, opts ...Option) *RoundTripper {
+	r := &RoundTripper{
+		exec: Executor{MaxRetries: maxRetries},
+	}
 
-		if err != nil {
-			log.Printf("customClient: doWithRetry.httpClient.Do if err != nil: %v\n", err)
+	for _, opt := range opts {
+		opt(r)
+	}
 
-			// check if error is temporary
-			if r.isRetryableError(err) {
-				// temp
-				log.Printf("backoff: %v\njitter: %v\n", r.backoff(attempts), r.jitter(r.maxJitter, attempts))
+	if r.base == nil {
+		// a clone keeps the proxy, dial and TLS handshake timeouts and HTTP/2 of the default transport
+		t := http.DefaultTransport.(*http.Transport).Clone()
+		if maxIdleConnsPerHost > 0 {
+			t.MaxIdleConnsPerHost = maxIdleConnsPerHost
+		}
 
-				// drain the response body to reuse the connection
-				r.drainBody(resp)
+		if idleConnTimeout > 0 {
+			t.IdleConnTimeout = idleConnTimeout
+		}
 
-				// wait for backoff time
-				time.Sleep(r.backoff(attempts) + r.jitter(r.maxJitter, attempts))
+		r.base = t
+	}
 
-				// continue to next attempt
-				continue
-			}
+	if r.maxJitter <= 0 {
+		r.maxJitter = 10
+	}
 
-			return nil, err
-		}
+	r.exec.Sanitize(time.Duration(r.maxJitter) * time.Millisecond)
 
-		// increment attempts
-		attempts++
+	return r
+}
 
-		log.Printf("customClient: doWithRetry after increment attempts: %d\n", attempts)
+// Middleware returns a roundtripper.Middleware which wraps its base with a retry RoundTripper
+func Middleware(maxRetries int, opts ...Option) func(http.RoundTripper) http.RoundTripper {
+	return func(base http.RoundTripper) http.RoundTripper {
+		return NewRoundTripper(maxRetries, 0, 0, append(slices.Clip(opts), WithBase(base))...)
 	}
+}
 
-	return resp, nil
+func (r *RoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	// use the base RoundTripper to make the attempts
+	return r.exec.Do(req, r.base.RoundTrip)
 }
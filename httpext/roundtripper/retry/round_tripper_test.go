@@ -0,0 +1,289 @@
+package retry_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/tanveerprottoy/stdlib-ext/httpext/backoff"
+	"github.com/tanveerprottoy/stdlib-ext/httpext/roundtripper"
+	"github.com/tanveerprottoy/stdlib-ext/httpext/roundtripper/retry"
+)
+
+func TestRoundTripper(t *testing.T) {
+	var calls atomic.Int32
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+
+	// subtest testRetriesUntilMaxRetries
+	t.Run("testRetriesUntilMaxRetries", func(t *testing.T) {
+		calls.Store(0)
+
+		rt := retry.NewRoundTripper(2, 10, time.Minute, retry.WithBackoff(backoff.NewConstant(0)))
+
+		req, _ := http.NewRequest(http.MethodGet, srv.URL, nil)
+
+		resp, err := rt.RoundTrip(req)
+		if err != nil {
+			t.Fatalf("RoundTrip error: %v", err)
+		}
+		defer resp.Body.Close()
+
+		if resp.StatusCode != http.StatusServiceUnavailable {
+			t.Errorf("expected status code 503, got %d", resp.StatusCode)
+		}
+
+		if calls.Load() != 3 {
+			t.Errorf("expected 3 calls, got %d", calls.Load())
+		}
+	})
+
+	// subtest testContextCancelledWhileWaiting
+	t.Run("testContextCancelledWhileWaiting", func(t *testing.T) {
+		rt := retry.NewRoundTripper(5, 10, time.Minute, retry.WithBackoff(backoff.NewConstant(time.Hour)))
+
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+
+		req, _ := http.NewRequestWithContext(ctx, http.MethodGet, srv.URL, nil)
+
+		start := time.Now()
+
+		_, err := rt.RoundTrip(req)
+
+		if time.Since(start) > 5*time.Second {
+			t.Errorf("RoundTrip did not return when the context expired")
+		}
+
+		var retryErr *retry.Error
+		if !errors.As(err, &retryErr) {
+			t.Fatalf("expected *retry.Error, got %v", err)
+		}
+
+		if retryErr.Attempts != 1 || retryErr.StatusCode != http.StatusServiceUnavailable {
+			t.Errorf("unexpected error fields: %+v", retryErr)
+		}
+
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("expected error to wrap context.DeadlineExceeded, got %v", err)
+		}
+	})
+
+	// subtest testContextCancelledDuringRetry
+	t.Run("testContextCancelledDuringRetry", func(t *testing.T) {
+		var attempts atomic.Int32
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		// the second attempt is cancelled while it is in flight
+		base := roundtripper.Func(func(req *http.Request) (*http.Response, error) {
+			if attempts.Add(1) == 1 {
+				return &http.Response{StatusCode: http.StatusServiceUnavailable, Body: http.NoBody}, nil
+			}
+
+			cancel()
+
+			return nil, req.Context().Err()
+		})
+
+		rt := retry.NewRoundTripper(5, 0, 0, retry.WithBase(base), retry.WithBackoff(backoff.NewConstant(0)))
+
+		req, _ := http.NewRequestWithContext(ctx, http.MethodGet, "http://example.com", nil)
+
+		_, err := rt.RoundTrip(req)
+
+		var retryErr *retry.Error
+		if !errors.As(err, &retryErr) {
+			t.Fatalf("expected *retry.Error, got %v", err)
+		}
+
+		if retryErr.Attempts != 2 || !errors.Is(err, context.Canceled) {
+			t.Errorf("unexpected error %+v", retryErr)
+		}
+	})
+
+	// subtest testSuccessAsTheContextEnds
+	t.Run("testSuccessAsTheContextEnds", func(t *testing.T) {
+		var attempts atomic.Int32
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		// the second attempt succeeds just as the context is cancelled
+		base := roundtripper.Func(func(req *http.Request) (*http.Response, error) {
+			if attempts.Add(1) == 1 {
+				return &http.Response{StatusCode: http.StatusServiceUnavailable, Body: http.NoBody}, nil
+			}
+
+			cancel()
+
+			return &http.Response{StatusCode: http.StatusOK, Body: http.NoBody}, nil
+		})
+
+		rt := retry.NewRoundTripper(5, 0, 0, retry.WithBase(base), retry.WithBackoff(backoff.NewConstant(0)))
+
+		req, _ := http.NewRequestWithContext(ctx, http.MethodGet, "http://example.com", nil)
+
+		resp, err := rt.RoundTrip(req)
+		if err != nil {
+			t.Fatalf("expected the successful response, got %v", err)
+		}
+		resp.Body.Close()
+
+		if resp.StatusCode != http.StatusOK {
+			t.Errorf("expected status code 200, got %d", resp.StatusCode)
+		}
+	})
+
+	// subtest testReplayBodyLimitIsKept
+	t.Run("testReplayBodyLimitIsKept", func(t *testing.T) {
+		calls.Store(0)
+
+		rt := retry.NewRoundTripper(2, 10, time.Minute, retry.WithReplayLimits(0, 512))
+
+		// without GetBody the body has to be buffered for replay
+		body := io.NopCloser(strings.NewReader(strings.Repeat("x", 1024)))
+		req, _ := http.NewRequest(http.MethodPut, srv.URL, body)
+
+		if _, err := rt.RoundTrip(req); !errors.Is(err, retry.ErrBodyTooLarge) {
+			t.Errorf("expected ErrBodyTooLarge, got %v", err)
+		}
+
+		if calls.Load() != 1 {
+			t.Errorf("expected the body to be sent once, got %d calls", calls.Load())
+		}
+	})
+
+	// subtest testLargeBodyIsStreamed
+	t.Run("testLargeBodyIsStreamed", func(t *testing.T) {
+		var received atomic.Int64
+
+		ok := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			n, _ := io.Copy(io.Discard, r.Body)
+			received.Store(n)
+		}))
+		defer ok.Close()
+
+		rt := retry.NewRoundTripper(2, 10, time.Minute, retry.WithReplayLimits(0, 512))
+
+		body := io.NopCloser(strings.NewReader(strings.Repeat("x", 1024)))
+		req, _ := http.NewRequest(http.MethodPut, ok.URL, body)
+
+		resp, err := rt.RoundTrip(req)
+		if err != nil {
+			t.Fatalf("expected a body above the replay limit to be sent once, got %v", err)
+		}
+		resp.Body.Close()
+
+		if received.Load() != 1024 {
+			t.Errorf("expected 1024 bytes, got %d", received.Load())
+		}
+	})
+
+	// subtest testMaxElapsedTime
+	t.Run("testMaxElapsedTime", func(t *testing.T) {
+		rt := retry.NewRoundTripper(
+			5, 10, time.Minute,
+			retry.WithBackoff(backoff.NewConstant(time.Minute)),
+			retry.WithMaxElapsedTime(time.Second),
+		)
+
+		req, _ := http.NewRequest(http.MethodGet, srv.URL, nil)
+
+		_, err := rt.RoundTrip(req)
+		if !errors.Is(err, retry.ErrMaxElapsedTime) {
+			t.Errorf("expected ErrMaxElapsedTime, got %v", err)
+		}
+	})
+
+	// subtest testNonIdempotentMethods
+	t.Run("testNonIdempotentMethods", func(t *testing.T) {
+		var (
+			posts atomic.Int32
+			keys  = make(chan string, 10)
+		)
+
+		echo := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			posts.Add(1)
+			keys <- r.Header.Get(retry.IdempotencyKeyHeader)
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}))
+		defer echo.Close()
+
+		rt := retry.NewRoundTripper(2, 10, time.Minute, retry.WithBackoff(backoff.NewConstant(0)))
+
+		req, _ := http.NewRequest(http.MethodPost, echo.URL, strings.NewReader("order"))
+
+		resp, err := rt.RoundTrip(req)
+		if err != nil {
+			t.Fatalf("RoundTrip error: %v", err)
+		}
+		resp.Body.Close()
+
+		if posts.Load() != 1 {
+			t.Errorf("expected POST not to be retried, got %d calls", posts.Load())
+		}
+		<-keys
+
+		posts.Store(0)
+
+		rt = retry.NewRoundTripper(
+			2, 10, time.Minute,
+			retry.WithBackoff(backoff.NewConstant(0)),
+			retry.WithIdempotencyKey(true),
+		)
+
+		req, _ = http.NewRequest(http.MethodPost, echo.URL, strings.NewReader("order"))
+
+		resp, err = rt.RoundTrip(req)
+		if err != nil {
+			t.Fatalf("RoundTrip error: %v", err)
+		}
+		resp.Body.Close()
+
+		if posts.Load() != 3 {
+			t.Errorf("expected 3 calls, got %d", posts.Load())
+		}
+
+		first := <-keys
+		if first == "" {
+			t.Fatalf("expected an Idempotency-Key header")
+		}
+
+		for i := 1; i < 3; i++ {
+			if key := <-keys; key != first {
+				t.Errorf("expected the same key on every attempt, got %q and %q", first, key)
+			}
+		}
+
+		if req.Header.Get(retry.IdempotencyKeyHeader) != "" {
+			t.Errorf("the caller's request must not be mutated")
+		}
+
+		// without retries there is no key to deduplicate attempts with
+		rt = retry.NewRoundTripper(0, 10, time.Minute, retry.WithIdempotencyKey(true))
+
+		req, _ = http.NewRequest(http.MethodPost, echo.URL, strings.NewReader("order"))
+
+		resp, err = rt.RoundTrip(req)
+		if err != nil {
+			t.Fatalf("RoundTrip error: %v", err)
+		}
+		resp.Body.Close()
+
+		if key := <-keys; key != "" {
+			t.Errorf("expected no Idempotency-Key without retries, got %q", key)
+		}
+	})
+}
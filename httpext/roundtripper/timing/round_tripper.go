@@ -0,0 +1,352 @@
+// Package timing provides a round tripper which breaks the latency of requests down into connection phases
+package timing
+
+import (
+	"context"
+	"crypto/tls"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptrace"
+	"sync"
+	"time"
+
+	"github.com/tanveerprottoy/stdlib-ext/httpext/metrics"
+)
+
+// Timings is the latency breakdown of a request, phases which didn't happen
+// (e.g. DNS and connect on a reused connection) are 0
+type Timings struct {
+	Start time.Time
+
+	DNS              time.Duration // resolving the host
+	Connect          time.Duration // establishing the TCP connection
+	TLSHandshake     time.Duration
+	ServerProcessing time.Duration // from the request being written to the first response byte
+	TimeToFirstByte  time.Duration // from the start to the first response byte
+	Transfer         time.Duration // reading the response body, set once the body is read or closed
+	Total            time.Duration // from the start to the end of the body, or to the response headers until then
+
+	ConnReused   bool          // the connection was used before
+	ConnWasIdle  bool          // the connection was taken from the idle pool
+	ConnIdleTime time.Duration // how long the connection was idle
+	RemoteAddr   string
+	TLSVersion   uint16
+}
+
+// LogValue implements slog.LogValuer
+func (t Timings) LogValue() slog.Value {
+	return slog.GroupValue(
+		slog.Duration("dns", t.DNS),
+		slog.Duration("connect", t.Connect),
+		slog.Duration("tls", t.TLSHandshake),
+		slog.Duration("server", t.ServerProcessing),
+		slog.Duration("ttfb", t.TimeToFirstByte),
+		slog.Duration("transfer", t.Transfer),
+		slog.Duration("total", t.Total),
+		slog.Bool("reused", t.ConnReused),
+		slog.String("remote_addr", t.RemoteAddr),
+	)
+}
+
+// PhaseObserver is implemented by a metrics.Metrics which records the timing phases, e.g. metrics.Expvar
+type PhaseObserver interface {
+	ObservePhase(host, method, phase string, d time.Duration)
+}
+
+// Recorder collects the timings of a request, it's safe for concurrent use
+// since the trace hooks may run on other goroutines
+type Recorder struct {
+	mu     sync.Mutex
+	t      Timings
+	starts phaseStarts
+}
+
+// phaseStarts are the points in time the phases are measured from
+type phaseStarts struct {
+	dns, connect, tls, wroteRequest, firstByte time.Time
+}
+
+// Timings returns the timings collected so far
+func (r *Recorder) Timings() Timings {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.t
+}
+
+func (r *Recorder) record(f func(now time.Time)) {
+	now := time.Now()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	f(now)
+}
+
+// publish replaces the timings with those of an attempt
+func (r *Recorder) publish(t Timings) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.t = t
+}
+
+type recorderKey struct{}
+
+// WithRecorder returns a context with a new Recorder, requests sent with it through a
+// RoundTripper record their timings there. A retried request keeps those of its last attempt,
+// a hedged request those of the winning attempt and a coalesced request those of the shared call
+func WithRecorder(ctx context.Context) (context.Context, *Recorder) {
+	r := &Recorder{}
+	return context.WithValue(ctx, recorderKey{}, r), r
+}
+
+// RecorderFromContext returns the Recorder of ctx
+func RecorderFromContext(ctx context.Context) (*Recorder, bool) {
+	r, ok := ctx.Value(recorderKey{}).(*Recorder)
+	return r, ok
+}
+
+// FromResponse returns the timings of a response returned by a RoundTripper
+func FromResponse(resp *http.Response) (Timings, bool) {
+	if resp == nil || resp.Request == nil {
+		return Timings{}, false
+	}
+
+	r, ok := RecorderFromContext(resp.Request.Context())
+	if !ok {
+		return Timings{}, false
+	}
+
+	return r.Timings(), true
+}
+
+// WithResponseTimings returns ctx with the timings of resp, for a response handed to another
+// request than the one which was sent, e.g. by a coalescing RoundTripper. A Recorder of ctx
+// receives the timings of resp recorded so far, otherwise ctx gets the Recorder of resp
+func WithResponseTimings(ctx context.Context, resp *http.Response) context.Context {
+	if resp == nil || resp.Request == nil {
+		return ctx
+	}
+
+	from, ok := RecorderFromContext(resp.Request.Context())
+	if !ok {
+		return ctx
+	}
+
+	if r, ok := RecorderFromContext(ctx); ok {
+		if r != from {
+			r.publish(from.Timings())
+		}
+
+		return ctx
+	}
+
+	return context.WithValue(ctx, recorderKey{}, from)
+}
+
+type Option func(*RoundTripper)
+
+// WithOnDone sets a callback invoked with the complete timings once the response body
+// was read or closed, or when the request failed
+func WithOnDone(f func(req *http.Request, t Timings)) Option {
+	return func(rt *RoundTripper) {
+		rt.onDone = f
+	}
+}
+
+// WithMetrics reports the phases to m if it implements PhaseObserver
+func WithMetrics(m metrics.Metrics) Option {
+	return func(rt *RoundTripper) {
+		rt.observer, _ = m.(PhaseObserver)
+	}
+}
+
+// RoundTripper traces every request with an httptrace.ClientTrace. It should wrap the
+// transport directly so that every attempt is traced on its own
+type RoundTripper struct {
+	onDone   func(req *http.Request, t Timings)
+	observer PhaseObserver
+
+	base http.RoundTripper
+}
+
+// NewRoundTripper creates a new timing RoundTripper.
+// If base is nil, http.DefaultTransport is used.
+func NewRoundTripper(base http.RoundTripper, opts ...Option) *RoundTripper {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+
+	rt := &RoundTripper{base: base}
+
+	for _, opt := range opts {
+		opt(rt)
+	}
+
+	return rt
+}
+
+// Middleware returns a roundtripper.Middleware which wraps its base with a timing RoundTripper
+func Middleware(opts ...Option) func(http.RoundTripper) http.RoundTripper {
+	return func(base http.RoundTripper) http.RoundTripper {
+		return NewRoundTripper(base, opts...)
+	}
+}
+
+func (rt *RoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	ctx := req.Context()
+
+	// every attempt records on its own, hedged attempts of a request run concurrently
+	r := &Recorder{t: Timings{Start: time.Now()}}
+
+	shared, ok := RecorderFromContext(ctx)
+	if !ok {
+		ctx = context.WithValue(ctx, recorderKey{}, r)
+		shared = r
+	}
+
+	// a cancelled attempt, e.g. a losing hedge, doesn't replace the timings of the others
+	publish := func() {
+		if shared != r && req.Context().Err() == nil {
+			shared.publish(r.Timings())
+		}
+	}
+
+	ctx = httptrace.WithClientTrace(ctx, r.clientTrace())
+
+	resp, err := rt.base.RoundTrip(req.WithContext(ctx))
+
+	r.record(func(now time.Time) {
+		r.t.Total = now.Sub(r.t.Start)
+	})
+
+	publish()
+
+	if err != nil {
+		rt.done(req, r)
+		return nil, err
+	}
+
+	resp.Body = &body{ReadCloser: resp.Body, done: func() {
+		r.record(func(now time.Time) {
+			if !r.starts.firstByte.IsZero() {
+				r.t.Transfer = now.Sub(r.starts.firstByte)
+			}
+
+			r.t.Total = now.Sub(r.t.Start)
+		})
+
+		publish()
+		rt.done(req, r)
+	}}
+
+	return resp, nil
+}
+
+// done reports the final timings
+func (rt *RoundTripper) done(req *http.Request, r *Recorder) {
+	t := r.Timings()
+
+	if rt.observer != nil {
+		for phase, d := range map[string]time.Duration{
+			"dns":      t.DNS,
+			"connect":  t.Connect,
+			"tls":      t.TLSHandshake,
+			"ttfb":     t.TimeToFirstByte,
+			"transfer": t.Transfer,
+		} {
+			// phases which didn't happen would skew the distributions
+			if d > 0 {
+				rt.observer.ObservePhase(req.URL.Host, req.Method, phase, d)
+			}
+		}
+	}
+
+	if rt.onDone != nil {
+		rt.onDone(req, t)
+	}
+}
+
+func (r *Recorder) clientTrace() *httptrace.ClientTrace {
+	return &httptrace.ClientTrace{
+		DNSStart: func(httptrace.DNSStartInfo) {
+			r.record(func(now time.Time) { r.starts.dns = now })
+		},
+		DNSDone: func(httptrace.DNSDoneInfo) {
+			r.record(func(now time.Time) { r.t.DNS = now.Sub(r.starts.dns) })
+		},
+		ConnectStart: func(string, string) {
+			r.record(func(now time.Time) {
+				// with happy eyeballs several dials race, the first start counts
+				if r.starts.connect.IsZero() {
+					r.starts.connect = now
+				}
+			})
+		},
+		ConnectDone: func(_, _ string, err error) {
+			r.record(func(now time.Time) {
+				if err == nil {
+					r.t.Connect = now.Sub(r.starts.connect)
+				}
+			})
+		},
+		TLSHandshakeStart: func() {
+			r.record(func(now time.Time) { r.starts.tls = now })
+		},
+		TLSHandshakeDone: func(state tls.ConnectionState, err error) {
+			r.record(func(now time.Time) {
+				r.t.TLSHandshake = now.Sub(r.starts.tls)
+				r.t.TLSVersion = state.Version
+			})
+		},
+		GotConn: func(info httptrace.GotConnInfo) {
+			r.record(func(time.Time) {
+				r.t.ConnReused = info.Reused
+				r.t.ConnWasIdle = info.WasIdle
+				r.t.ConnIdleTime = info.IdleTime
+
+				if info.Conn != nil {
+					r.t.RemoteAddr = info.Conn.RemoteAddr().String()
+				}
+			})
+		},
+		WroteRequest: func(httptrace.WroteRequestInfo) {
+			r.record(func(now time.Time) { r.starts.wroteRequest = now })
+		},
+		GotFirstResponseByte: func() {
+			r.record(func(now time.Time) {
+				r.starts.firstByte = now
+				r.t.TimeToFirstByte = now.Sub(r.t.Start)
+
+				if !r.starts.wroteRequest.IsZero() {
+					r.t.ServerProcessing = now.Sub(r.starts.wroteRequest)
+				}
+			})
+		},
+	}
+}
+
+// body calls done once when it's read to the end or closed
+type body struct {
+	io.ReadCloser
+	once sync.Once
+	done func()
+}
+
+func (b *body) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if err == io.EOF {
+		b.once.Do(b.done)
+	}
+
+	return n, err
+}
+
+func (b *body) Close() error {
+	err := b.ReadCloser.Close()
+	b.once.Do(b.done)
+
+	return err
+}
@@ -0,0 +1,151 @@
+package timing_test
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/http/httptrace"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/tanveerprottoy/stdlib-ext/httpext/metrics"
+	"github.com/tanveerprottoy/stdlib-ext/httpext/roundtripper"
+	"github.com/tanveerprottoy/stdlib-ext/httpext/roundtripper/hedge"
+	"github.com/tanveerprottoy/stdlib-ext/httpext/roundtripper/timing"
+)
+
+func TestRoundTripper(t *testing.T) {
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(5 * time.Millisecond)
+		w.Write([]byte("ok"))
+	}))
+	defer srv.Close()
+
+	var done atomic.Int32
+
+	m := metrics.NewExpvar("")
+	rt := timing.NewRoundTripper(
+		srv.Client().Transport,
+		timing.WithMetrics(m),
+		timing.WithOnDone(func(req *http.Request, tm timing.Timings) {
+			done.Add(1)
+		}),
+	)
+
+	roundTrip := func(ctx context.Context) (*http.Response, timing.Timings) {
+		t.Helper()
+
+		req, _ := http.NewRequestWithContext(ctx, http.MethodGet, srv.URL, nil)
+
+		resp, err := rt.RoundTrip(req)
+		if err != nil {
+			t.Fatalf("RoundTrip error: %v", err)
+		}
+
+		io.ReadAll(resp.Body)
+		resp.Body.Close()
+
+		tm, ok := timing.FromResponse(resp)
+		if !ok {
+			t.Fatalf("expected timings on the response")
+		}
+
+		return resp, tm
+	}
+
+	// subtest testNewConnection
+	t.Run("testNewConnection", func(t *testing.T) {
+		_, tm := roundTrip(context.Background())
+
+		if tm.ConnReused {
+			t.Errorf("expected a new connection")
+		}
+
+		if tm.Connect <= 0 || tm.TLSHandshake <= 0 {
+			t.Errorf("expected connect and TLS durations, got %+v", tm)
+		}
+
+		if tm.ServerProcessing < 5*time.Millisecond || tm.TimeToFirstByte < tm.ServerProcessing {
+			t.Errorf("expected the server processing time in the time to first byte, got %+v", tm)
+		}
+
+		if tm.Total < tm.TimeToFirstByte {
+			t.Errorf("expected the total to include the time to first byte, got %+v", tm)
+		}
+	})
+
+	// subtest testReusedConnectionWithRecorder
+	t.Run("testReusedConnectionWithRecorder", func(t *testing.T) {
+		ctx, recorder := timing.WithRecorder(context.Background())
+
+		roundTrip(ctx)
+
+		tm := recorder.Timings()
+		if !tm.ConnReused || tm.Connect != 0 || tm.TLSHandshake != 0 {
+			t.Errorf("expected a reused connection without connect and TLS, got %+v", tm)
+		}
+	})
+
+	if done.Load() != 2 {
+		t.Errorf("expected 2 OnDone calls, got %d", done.Load())
+	}
+
+	var b strings.Builder
+	m.WritePrometheus(&b)
+
+	host := strings.TrimPrefix(srv.URL, "https://")
+
+	for _, line := range []string{
+		`httpext_phase_duration_seconds_count{host="` + host + `",method="GET",phase="tls"} 1`,
+		`httpext_phase_duration_seconds_count{host="` + host + `",method="GET",phase="ttfb"} 2`,
+	} {
+		if !strings.Contains(b.String(), line) {
+			t.Errorf("expected line %q in:\n%s", line, b.String())
+		}
+	}
+}
+
+func TestHedgedAttempts(t *testing.T) {
+	var sent atomic.Int32
+
+	loserDone := make(chan struct{})
+
+	// the first attempt hangs and still traces after it was cancelled,
+	// the hedge answers at once on a reused connection
+	base := roundtripper.Func(func(req *http.Request) (*http.Response, error) {
+		trace := httptrace.ContextClientTrace(req.Context())
+
+		if sent.Add(1) == 1 {
+			defer close(loserDone)
+
+			<-req.Context().Done()
+			trace.GotConn(httptrace.GotConnInfo{Reused: false})
+
+			return nil, req.Context().Err()
+		}
+
+		trace.GotConn(httptrace.GotConnInfo{Reused: true})
+
+		return &http.Response{StatusCode: http.StatusOK, Body: http.NoBody, Request: req}, nil
+	})
+
+	rt := hedge.NewRoundTripper(hedge.Config{Delay: 20 * time.Millisecond}, timing.NewRoundTripper(base))
+
+	ctx, recorder := timing.WithRecorder(context.Background())
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, "http://example.com", nil)
+
+	resp, err := rt.RoundTrip(req)
+	if err != nil {
+		t.Fatalf("RoundTrip error: %v", err)
+	}
+	resp.Body.Close()
+
+	<-loserDone
+
+	if tm := recorder.Timings(); !tm.ConnReused {
+		t.Errorf("expected the timings of the winning attempt, got %+v", tm)
+	}
+}
@@ -0,0 +1,276 @@
+// Package tracing provides W3C trace context propagation and client spans for outgoing requests
+// without depending on an OpenTelemetry SDK, which can be plugged in through the Tracer interface
+package tracing
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+)
+
+// W3C Trace Context and Baggage headers
+const (
+	TraceparentHeader = "Traceparent"
+	TracestateHeader  = "Tracestate"
+	BaggageHeader     = "Baggage"
+)
+
+// limits of the W3C Baggage specification
+const (
+	maxBaggageMembers = 180
+	maxBaggageBytes   = 8192
+)
+
+// ErrInvalidTraceparent is returned for a malformed traceparent header
+var ErrInvalidTraceparent = errors.New("tracing: invalid traceparent")
+
+type TraceID [16]byte
+
+func (id TraceID) IsValid() bool {
+	return id != TraceID{}
+}
+
+func (id TraceID) String() string {
+	return hex.EncodeToString(id[:])
+}
+
+type SpanID [8]byte
+
+func (id SpanID) IsValid() bool {
+	return id != SpanID{}
+}
+
+func (id SpanID) String() string {
+	return hex.EncodeToString(id[:])
+}
+
+// FlagSampled is the trace flag recording that the caller may have sampled the trace
+const FlagSampled byte = 0x01
+
+// SpanContext identifies a span across process boundaries
+type SpanContext struct {
+	TraceID    TraceID
+	SpanID     SpanID
+	Flags      byte
+	TraceState string // vendor specific tracestate header value, passed on unchanged
+	Remote     bool   // extracted from an incoming request
+}
+
+func (sc SpanContext) IsValid() bool {
+	return sc.TraceID.IsValid() && sc.SpanID.IsValid()
+}
+
+func (sc SpanContext) IsSampled() bool {
+	return sc.Flags&FlagSampled != 0
+}
+
+// Traceparent formats sc as a version 00 traceparent header value
+func (sc SpanContext) Traceparent() string {
+	return fmt.Sprintf("00-%s-%s-%02x", sc.TraceID, sc.SpanID, sc.Flags)
+}
+
+// ParseTraceparent parses a traceparent header value, future versions are accepted
+// as long as their first four fields have the version 00 format
+func ParseTraceparent(v string) (SpanContext, error) {
+	parts := strings.Split(strings.TrimSpace(v), "-")
+	if len(parts) < 4 {
+		return SpanContext{}, ErrInvalidTraceparent
+	}
+
+	version, traceID, spanID, flags := parts[0], parts[1], parts[2], parts[3]
+
+	if len(version) != 2 || version == "ff" || !isLowerHex(version) ||
+		(version == "00" && len(parts) != 4) {
+		return SpanContext{}, ErrInvalidTraceparent
+	}
+
+	var sc SpanContext
+
+	if len(traceID) != 32 || !isLowerHex(traceID) || len(spanID) != 16 || !isLowerHex(spanID) ||
+		len(flags) != 2 || !isLowerHex(flags) {
+		return SpanContext{}, ErrInvalidTraceparent
+	}
+
+	hex.Decode(sc.TraceID[:], []byte(traceID))
+	hex.Decode(sc.SpanID[:], []byte(spanID))
+
+	var f [1]byte
+	hex.Decode(f[:], []byte(flags))
+	sc.Flags = f[0]
+
+	if !sc.IsValid() {
+		return SpanContext{}, ErrInvalidTraceparent
+	}
+
+	return sc, nil
+}
+
+func isLowerHex(s string) bool {
+	for _, c := range s {
+		if (c < '0' || c > '9') && (c < 'a' || c > 'f') {
+			return false
+		}
+	}
+
+	return true
+}
+
+type spanContextKey struct{}
+
+// ContextWithSpanContext returns a context carrying sc, e.g. extracted from an incoming request
+func ContextWithSpanContext(ctx context.Context, sc SpanContext) context.Context {
+	return context.WithValue(ctx, spanContextKey{}, sc)
+}
+
+// SpanContextFromContext returns the SpanContext of the current span or the one set
+// with ContextWithSpanContext
+func SpanContextFromContext(ctx context.Context) SpanContext {
+	if span, ok := ctx.Value(spanKey{}).(Span); ok {
+		return span.SpanContext()
+	}
+
+	sc, _ := ctx.Value(spanContextKey{}).(SpanContext)
+
+	return sc
+}
+
+// Extract returns a context carrying the span context and baggage of an incoming request
+func Extract(ctx context.Context, h http.Header) context.Context {
+	if sc, err := ParseTraceparent(h.Get(TraceparentHeader)); err == nil {
+		sc.TraceState = strings.Join(h.Values(TracestateHeader), ",")
+		sc.Remote = true
+		ctx = ContextWithSpanContext(ctx, sc)
+	}
+
+	if b, err := ParseBaggage(strings.Join(h.Values(BaggageHeader), ",")); err == nil && len(b) > 0 {
+		ctx = ContextWithBaggage(ctx, b)
+	}
+
+	return ctx
+}
+
+// Inject sets the trace context and baggage headers of ctx on h
+func Inject(ctx context.Context, h http.Header) {
+	if sc := SpanContextFromContext(ctx); sc.IsValid() {
+		h.Set(TraceparentHeader, sc.Traceparent())
+
+		if sc.TraceState != "" {
+			h.Set(TracestateHeader, sc.TraceState)
+		} else {
+			h.Del(TracestateHeader)
+		}
+	}
+
+	if b := BaggageFromContext(ctx); len(b) > 0 {
+		h.Set(BaggageHeader, b.String())
+	}
+}
+
+// Member is a baggage entry, Properties are kept verbatim, e.g. "ttl=60"
+type Member struct {
+	Key        string
+	Value      string
+	Properties string
+}
+
+// Baggage is the set of application defined key values propagated with a trace
+type Baggage []Member
+
+// Get returns the value of key
+func (b Baggage) Get(key string) (string, bool) {
+	i := slices.IndexFunc(b, func(m Member) bool { return m.Key == key })
+	if i < 0 {
+		return "", false
+	}
+
+	return b[i].Value, true
+}
+
+// With returns a copy of b with key set to value
+func (b Baggage) With(key, value string) Baggage {
+	clone := slices.DeleteFunc(slices.Clone(b), func(m Member) bool { return m.Key == key })
+	return append(clone, Member{Key: key, Value: value})
+}
+
+// String formats b as a baggage header value, members beyond the W3C limits are dropped
+func (b Baggage) String() string {
+	var sb strings.Builder
+
+	for i, m := range b {
+		if i >= maxBaggageMembers {
+			break
+		}
+
+		member := m.Key + "=" + url.PathEscape(m.Value)
+		if m.Properties != "" {
+			member += ";" + m.Properties
+		}
+
+		if sb.Len()+len(member)+1 > maxBaggageBytes {
+			break
+		}
+
+		if i > 0 {
+			sb.WriteByte(',')
+		}
+
+		sb.WriteString(member)
+	}
+
+	return sb.String()
+}
+
+// ParseBaggage parses a baggage header value
+func ParseBaggage(v string) (Baggage, error) {
+	if len(v) > maxBaggageBytes {
+		return nil, errors.New("tracing: baggage exceeds 8192 bytes")
+	}
+
+	var b Baggage
+
+	for _, member := range strings.Split(v, ",") {
+		member = strings.TrimSpace(member)
+		if member == "" {
+			continue
+		}
+
+		kv, props, _ := strings.Cut(member, ";")
+
+		key, value, ok := strings.Cut(kv, "=")
+		key = strings.TrimSpace(key)
+		if !ok || key == "" {
+			return nil, fmt.Errorf("tracing: invalid baggage member %q", member)
+		}
+
+		value, err := url.PathUnescape(strings.TrimSpace(value))
+		if err != nil {
+			return nil, fmt.Errorf("tracing: invalid baggage value of %q: %w", key, err)
+		}
+
+		b = append(b, Member{Key: key, Value: value, Properties: strings.TrimSpace(props)})
+	}
+
+	if len(b) > maxBaggageMembers {
+		return nil, errors.New("tracing: baggage exceeds 180 members")
+	}
+
+	return b, nil
+}
+
+type baggageKey struct{}
+
+// ContextWithBaggage returns a context carrying b
+func ContextWithBaggage(ctx context.Context, b Baggage) context.Context {
+	return context.WithValue(ctx, baggageKey{}, b)
+}
+
+// BaggageFromContext returns the baggage of ctx
+func BaggageFromContext(ctx context.Context) Baggage {
+	b, _ := ctx.Value(baggageKey{}).(Baggage)
+	return b
+}
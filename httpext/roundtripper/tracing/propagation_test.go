@@ -0,0 +1,88 @@
+package tracing_test
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/tanveerprottoy/stdlib-ext/httpext/roundtripper/tracing"
+)
+
+func TestParseTraceparent(t *testing.T) {
+	tests := []struct {
+		name    string
+		value   string
+		wantErr bool
+	}{
+		{"valid", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", false},
+		{"futureVersionWithExtraField", "01-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra", false},
+		{"version00WithExtraField", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra", true},
+		{"versionFF", "ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", true},
+		{"zeroTraceID", "00-00000000000000000000000000000000-00f067aa0ba902b7-01", true},
+		{"zeroSpanID", "00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01", true},
+		{"uppercase", "00-4BF92F3577B34DA6A3CE929D0E0E4736-00f067aa0ba902b7-01", true},
+		{"short", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sc, err := tracing.ParseTraceparent(tt.value)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseTraceparent(%q) error = %v, wantErr %v", tt.value, err, tt.wantErr)
+			}
+
+			if err == nil && !sc.IsSampled() {
+				t.Errorf("expected the sampled flag")
+			}
+		})
+	}
+
+	sc, _ := tracing.ParseTraceparent("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	if got := sc.Traceparent(); got != "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01" {
+		t.Errorf("Traceparent() = %q", got)
+	}
+}
+
+func TestBaggage(t *testing.T) {
+	b, err := tracing.ParseBaggage("userId=alice, serverNode=DF%2028;ttl=60,isProduction=false")
+	if err != nil {
+		t.Fatalf("ParseBaggage error: %v", err)
+	}
+
+	if v, _ := b.Get("serverNode"); v != "DF 28" {
+		t.Errorf("expected serverNode DF 28, got %q", v)
+	}
+
+	b = b.With("userId", "bob")
+
+	if got, want := b.String(), "serverNode=DF%2028;ttl=60,isProduction=false,userId=bob"; got != want {
+		t.Errorf("String() = %q, want %q", got, want)
+	}
+
+	if _, err := tracing.ParseBaggage("novalue"); err == nil {
+		t.Errorf("expected an error for a member without value")
+	}
+}
+
+func TestExtractInject(t *testing.T) {
+	in := http.Header{}
+	in.Set(tracing.TraceparentHeader, "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	in.Set(tracing.TracestateHeader, "congo=t61rcWkgMzE")
+	in.Set(tracing.BaggageHeader, "userId=alice")
+
+	ctx := tracing.Extract(context.Background(), in)
+
+	sc := tracing.SpanContextFromContext(ctx)
+	if !sc.Remote || sc.TraceID.String() != "4bf92f3577b34da6a3ce929d0e0e4736" {
+		t.Errorf("unexpected span context %+v", sc)
+	}
+
+	out := http.Header{}
+	tracing.Inject(ctx, out)
+
+	for _, name := range []string{tracing.TraceparentHeader, tracing.TracestateHeader, tracing.BaggageHeader} {
+		if out.Get(name) != in.Get(name) {
+			t.Errorf("%s: expected %q, got %q", name, in.Get(name), out.Get(name))
+		}
+	}
+}
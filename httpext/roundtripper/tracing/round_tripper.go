@@ -0,0 +1,175 @@
+package tracing
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+
+	"github.com/tanveerprottoy/stdlib-ext/httpext/roundtripper/logging"
+	"github.com/tanveerprottoy/stdlib-ext/httpext/roundtripper/retry"
+)
+
+type Option func(*RoundTripper)
+
+// WithSpanNameFunc sets the function naming client spans, the request method by default
+func WithSpanNameFunc(f func(req *http.Request) string) Option {
+	return func(rt *RoundTripper) {
+		rt.spanName = f
+	}
+}
+
+// WithRedactedQueryParams replaces the query parameters whose values are redacted in url.full,
+// logging.DefaultRedactedQueryParams by default. "*" redacts every value
+func WithRedactedQueryParams(names ...string) Option {
+	return func(rt *RoundTripper) {
+		rt.redactedQuery = names
+	}
+}
+
+// RoundTripper creates a client span for every request and propagates it with the
+// traceparent, tracestate and baggage headers. Without a Tracer it only propagates
+// the span context and baggage of the request context
+type RoundTripper struct {
+	tracer   Tracer
+	spanName func(req *http.Request) string
+
+	redactedQuery []string
+
+	base http.RoundTripper
+}
+
+// NewRoundTripper creates a new tracing RoundTripper, t may be nil for propagation only.
+// If base is nil, http.DefaultTransport is used.
+func NewRoundTripper(t Tracer, base http.RoundTripper, opts ...Option) *RoundTripper {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+
+	rt := &RoundTripper{
+		tracer: t,
+		spanName: func(req *http.Request) string {
+			return req.Method
+		},
+		redactedQuery: logging.DefaultRedactedQueryParams,
+		base:          base,
+	}
+
+	for _, opt := range opts {
+		opt(rt)
+	}
+
+	return rt
+}
+
+// Middleware returns a roundtripper.Middleware which wraps its base with a tracing RoundTripper
+func Middleware(t Tracer, opts ...Option) func(http.RoundTripper) http.RoundTripper {
+	return func(base http.RoundTripper) http.RoundTripper {
+		return NewRoundTripper(t, base, opts...)
+	}
+}
+
+func (rt *RoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	ctx := req.Context()
+
+	var span Span
+	if rt.tracer != nil {
+		ctx, span = rt.tracer.Start(ctx, rt.spanName(req), rt.requestAttrs(req)...)
+	}
+
+	// the caller's request must not be mutated
+	clone := req.Clone(ctx)
+	Inject(ctx, clone.Header)
+
+	resp, err := rt.base.RoundTrip(clone)
+
+	if span == nil {
+		return resp, err
+	}
+
+	if err != nil {
+		span.RecordError(err)
+		span.SetAttributes(slog.String("error.type", fmt.Sprintf("%T", err)))
+		span.SetStatus(StatusError, err.Error())
+		span.End()
+
+		return nil, err
+	}
+
+	span.SetAttributes(slog.Int("http.response.status_code", resp.StatusCode))
+
+	// client spans treat 4xx as errors too, as the OpenTelemetry HTTP conventions do
+	if resp.StatusCode >= http.StatusBadRequest {
+		span.SetAttributes(slog.String("error.type", strconv.Itoa(resp.StatusCode)))
+		span.SetStatus(StatusError, "")
+	}
+
+	// the span covers the body transfer
+	resp.Body = &endBody{ReadCloser: resp.Body, span: span}
+
+	return resp, nil
+}
+
+// requestAttrs are the OpenTelemetry HTTP client attributes of req,
+// url.full has no user info and sensitive query values are redacted
+func (rt *RoundTripper) requestAttrs(req *http.Request) []slog.Attr {
+	u := *req.URL
+	u.User = nil
+
+	attrs := []slog.Attr{
+		slog.String("http.request.method", req.Method),
+		slog.String("url.full", logging.RedactURL(&u, rt.redactedQuery)),
+	}
+
+	host, port, err := net.SplitHostPort(req.URL.Host)
+	if err != nil {
+		host = req.URL.Host
+
+		switch req.URL.Scheme {
+		case "https":
+			port = "443"
+		case "http":
+			port = "80"
+		}
+	}
+
+	attrs = append(attrs, slog.String("server.address", host))
+
+	if p, err := strconv.Atoi(port); err == nil {
+		attrs = append(attrs, slog.Int("server.port", p))
+	}
+
+	if attempt, ok := retry.AttemptFromContext(req.Context()); ok && attempt > 0 {
+		attrs = append(attrs, slog.Int("http.request.resend_count", attempt))
+	}
+
+	return attrs
+}
+
+// endBody ends the span once the body is read to the end or closed
+type endBody struct {
+	io.ReadCloser
+	span Span
+	once sync.Once
+}
+
+func (b *endBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if err == io.EOF {
+		b.once.Do(b.span.End)
+	} else if err != nil {
+		b.span.RecordError(err)
+	}
+
+	return n, err
+}
+
+func (b *endBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.once.Do(b.span.End)
+
+	return err
+}
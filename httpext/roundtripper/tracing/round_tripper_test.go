@@ -0,0 +1,174 @@
+package tracing_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/tanveerprottoy/stdlib-ext/httpext/roundtripper"
+	"github.com/tanveerprottoy/stdlib-ext/httpext/roundtripper/tracing"
+)
+
+func TestRoundTripper(t *testing.T) {
+	var received http.Header
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received = r.Header.Clone()
+		if r.URL.Path == "/missing" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Write([]byte("ok"))
+	}))
+	defer srv.Close()
+
+	exporter := tracing.NewInMemoryExporter()
+	rt := tracing.NewRoundTripper(tracing.NewTracer(exporter), nil)
+
+	parent, _ := tracing.ParseTraceparent("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+
+	// subtest testClientSpan
+	t.Run("testClientSpan", func(t *testing.T) {
+		exporter.Reset()
+
+		ctx := tracing.ContextWithSpanContext(context.Background(), parent)
+		ctx = tracing.ContextWithBaggage(ctx, tracing.Baggage{}.With("tenant", "acme"))
+
+		req, _ := http.NewRequestWithContext(ctx, http.MethodGet, srv.URL+"/items?id=1", nil)
+
+		resp, err := rt.RoundTrip(req)
+		if err != nil {
+			t.Fatalf("RoundTrip error: %v", err)
+		}
+
+		if len(exporter.Spans()) != 0 {
+			t.Errorf("expected the span to end with the body")
+		}
+
+		io.ReadAll(resp.Body)
+		resp.Body.Close()
+
+		if req.Header.Get(tracing.TraceparentHeader) != "" {
+			t.Errorf("expected the caller's request to be left alone")
+		}
+
+		spans := exporter.Spans()
+		if len(spans) != 1 {
+			t.Fatalf("expected 1 span, got %d", len(spans))
+		}
+
+		span := spans[0]
+
+		if span.SpanContext.TraceID != parent.TraceID || span.Parent.SpanID != parent.SpanID {
+			t.Errorf("expected a child of the parent span, got %+v", span)
+		}
+
+		if got := received.Get(tracing.TraceparentHeader); got != span.SpanContext.Traceparent() {
+			t.Errorf("expected traceparent %q, got %q", span.SpanContext.Traceparent(), got)
+		}
+
+		if got := received.Get(tracing.BaggageHeader); got != "tenant=acme" {
+			t.Errorf("expected baggage tenant=acme, got %q", got)
+		}
+
+		if v, _ := span.Attr("http.request.method"); v.String() != http.MethodGet {
+			t.Errorf("expected method GET, got %v", v)
+		}
+
+		if v, _ := span.Attr("url.full"); v.String() != srv.URL+"/items?id=1" {
+			t.Errorf("expected url.full, got %v", v)
+		}
+
+		if v, _ := span.Attr("http.response.status_code"); v.Int64() != http.StatusOK {
+			t.Errorf("expected status code 200, got %v", v)
+		}
+
+		if span.Status != tracing.StatusUnset {
+			t.Errorf("expected unset status, got %v", span.Status)
+		}
+	})
+
+	// subtest testRedactedQuery
+	t.Run("testRedactedQuery", func(t *testing.T) {
+		exporter.Reset()
+
+		req, _ := http.NewRequest(http.MethodGet, srv.URL+"/items?api_key=secret&id=1", nil)
+
+		resp, err := rt.RoundTrip(req)
+		if err != nil {
+			t.Fatalf("RoundTrip error: %v", err)
+		}
+		resp.Body.Close()
+
+		spans := exporter.Spans()
+		if len(spans) != 1 {
+			t.Fatalf("expected 1 span, got %d", len(spans))
+		}
+
+		if v, _ := spans[0].Attr("url.full"); v.String() != srv.URL+"/items?api_key=REDACTED&id=1" {
+			t.Errorf("expected the API key to be redacted, got %v", v)
+		}
+	})
+
+	// subtest testErrorStatus
+	t.Run("testErrorStatus", func(t *testing.T) {
+		exporter.Reset()
+
+		req, _ := http.NewRequest(http.MethodGet, srv.URL+"/missing", nil)
+
+		resp, err := rt.RoundTrip(req)
+		if err != nil {
+			t.Fatalf("RoundTrip error: %v", err)
+		}
+		resp.Body.Close()
+
+		spans := exporter.Spans()
+		if len(spans) != 1 || spans[0].Status != tracing.StatusError {
+			t.Fatalf("expected 1 span with error status, got %+v", spans)
+		}
+
+		if spans[0].Parent.IsValid() {
+			t.Errorf("expected a root span")
+		}
+	})
+
+	// subtest testTransportError
+	t.Run("testTransportError", func(t *testing.T) {
+		exporter.Reset()
+
+		failing := tracing.NewRoundTripper(tracing.NewTracer(exporter), roundtripper.Func(func(req *http.Request) (*http.Response, error) {
+			return nil, errors.New("connection refused")
+		}))
+
+		req, _ := http.NewRequest(http.MethodGet, "http://example.com", nil)
+
+		if _, err := failing.RoundTrip(req); err == nil {
+			t.Fatalf("expected an error")
+		}
+
+		spans := exporter.Spans()
+		if len(spans) != 1 || spans[0].Status != tracing.StatusError || len(spans[0].Errors) != 1 {
+			t.Errorf("expected 1 span with the error recorded, got %+v", spans)
+		}
+	})
+
+	// subtest testPropagationOnly
+	t.Run("testPropagationOnly", func(t *testing.T) {
+		propagator := tracing.NewRoundTripper(nil, nil)
+
+		req, _ := http.NewRequestWithContext(tracing.ContextWithSpanContext(context.Background(), parent), http.MethodGet, srv.URL, nil)
+
+		resp, err := propagator.RoundTrip(req)
+		if err != nil {
+			t.Fatalf("RoundTrip error: %v", err)
+		}
+		resp.Body.Close()
+
+		if got := received.Get(tracing.TraceparentHeader); got != parent.Traceparent() {
+			t.Errorf("expected traceparent %q, got %q", parent.Traceparent(), got)
+		}
+	})
+}
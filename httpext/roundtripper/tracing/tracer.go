@@ -0,0 +1,276 @@
+package tracing
+
+import (
+	"context"
+	"encoding/binary"
+	"log/slog"
+	"math/rand/v2"
+	"slices"
+	"sync"
+	"time"
+)
+
+// StatusCode is the status of a span, following OpenTelemetry
+type StatusCode int
+
+const (
+	StatusUnset StatusCode = iota
+	StatusError
+	StatusOK
+)
+
+func (c StatusCode) String() string {
+	switch c {
+	case StatusError:
+		return "error"
+	case StatusOK:
+		return "ok"
+	default:
+		return "unset"
+	}
+}
+
+// Tracer creates spans, it can be implemented on top of an OpenTelemetry tracer
+type Tracer interface {
+	// Start creates a span which is a child of the span of ctx, if any,
+	// and returns a context carrying it
+	Start(ctx context.Context, name string, attrs ...slog.Attr) (context.Context, Span)
+}
+
+// Span is an operation in a trace
+type Span interface {
+	SpanContext() SpanContext
+	SetAttributes(attrs ...slog.Attr)
+	RecordError(err error)
+	SetStatus(code StatusCode, description string)
+
+	// End completes the span, calls after the first have no effect
+	End()
+}
+
+type spanKey struct{}
+
+// ContextWithSpan returns a context carrying span, Tracer implementations should use it
+// so that SpanContextFromContext and Inject see their spans
+func ContextWithSpan(ctx context.Context, span Span) context.Context {
+	return context.WithValue(ctx, spanKey{}, span)
+}
+
+// SpanFromContext returns the current span of ctx
+func SpanFromContext(ctx context.Context) (Span, bool) {
+	span, ok := ctx.Value(spanKey{}).(Span)
+	return span, ok
+}
+
+// SpanData is a completed span handed to an Exporter
+type SpanData struct {
+	Name              string
+	SpanContext       SpanContext
+	Parent            SpanContext
+	Start             time.Time
+	End               time.Time
+	Attributes        []slog.Attr
+	Errors            []error
+	Status            StatusCode
+	StatusDescription string
+}
+
+// Attr returns the value of the attribute key
+func (d SpanData) Attr(key string) (slog.Value, bool) {
+	i := slices.IndexFunc(d.Attributes, func(a slog.Attr) bool { return a.Key == key })
+	if i < 0 {
+		return slog.Value{}, false
+	}
+
+	return d.Attributes[i].Value, true
+}
+
+// Exporter receives the sampled spans of a Tracer when they end
+type Exporter interface {
+	Export(span SpanData)
+}
+
+// InMemoryExporter keeps the exported spans, e.g. for tests
+type InMemoryExporter struct {
+	mu    sync.Mutex
+	spans []SpanData
+}
+
+func NewInMemoryExporter() *InMemoryExporter {
+	return &InMemoryExporter{}
+}
+
+func (e *InMemoryExporter) Export(span SpanData) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.spans = append(e.spans, span)
+}
+
+// Spans returns the exported spans in the order they ended
+func (e *InMemoryExporter) Spans() []SpanData {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	return slices.Clone(e.spans)
+}
+
+// Reset removes the exported spans
+func (e *InMemoryExporter) Reset() {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.spans = nil
+}
+
+type TracerOption func(*tracer)
+
+// WithSampleRatio samples the given fraction [0, 1] of new traces, 1 by default.
+// Spans with a parent follow the sampling decision of the parent
+func WithSampleRatio(ratio float64) TracerOption {
+	return func(t *tracer) {
+		t.sampleRatio = ratio
+	}
+}
+
+// tracer is the Tracer of NewTracer
+type tracer struct {
+	exporter    Exporter
+	sampleRatio float64
+}
+
+// NewTracer creates a Tracer which exports its sampled spans to exporter
+func NewTracer(exporter Exporter, opts ...TracerOption) Tracer {
+	t := &tracer{exporter: exporter, sampleRatio: 1}
+
+	for _, opt := range opts {
+		opt(t)
+	}
+
+	return t
+}
+
+func (t *tracer) Start(ctx context.Context, name string, attrs ...slog.Attr) (context.Context, Span) {
+	parent := SpanContextFromContext(ctx)
+
+	sc := SpanContext{SpanID: newSpanID()}
+
+	if parent.IsValid() {
+		sc.TraceID = parent.TraceID
+		sc.Flags = parent.Flags
+		sc.TraceState = parent.TraceState
+	} else {
+		sc.TraceID = newTraceID()
+
+		if rand.Float64() < t.sampleRatio {
+			sc.Flags = FlagSampled
+		}
+	}
+
+	s := &span{
+		tracer: t,
+		data: SpanData{
+			Name:        name,
+			SpanContext: sc,
+			Parent:      parent,
+			Start:       time.Now(),
+			Attributes:  slices.Clone(attrs),
+		},
+	}
+
+	return ContextWithSpan(ctx, s), s
+}
+
+func newTraceID() TraceID {
+	var id TraceID
+	for !id.IsValid() {
+		binary.LittleEndian.PutUint64(id[:8], rand.Uint64())
+		binary.LittleEndian.PutUint64(id[8:], rand.Uint64())
+	}
+
+	return id
+}
+
+func newSpanID() SpanID {
+	var id SpanID
+	for !id.IsValid() {
+		binary.LittleEndian.PutUint64(id[:], rand.Uint64())
+	}
+
+	return id
+}
+
+// span is the Span of tracer, it's safe for concurrent use and read-only once ended
+type span struct {
+	tracer *tracer
+
+	mu    sync.Mutex
+	data  SpanData
+	ended bool
+}
+
+func (s *span) SpanContext() SpanContext {
+	// immutable after Start
+	return s.data.SpanContext
+}
+
+func (s *span) SetAttributes(attrs ...slog.Attr) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.ended {
+		return
+	}
+
+	for _, attr := range attrs {
+		i := slices.IndexFunc(s.data.Attributes, func(a slog.Attr) bool { return a.Key == attr.Key })
+		if i >= 0 {
+			s.data.Attributes[i] = attr
+		} else {
+			s.data.Attributes = append(s.data.Attributes, attr)
+		}
+	}
+}
+
+func (s *span) RecordError(err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.ended {
+		return
+	}
+
+	s.data.Errors = append(s.data.Errors, err)
+}
+
+func (s *span) SetStatus(code StatusCode, description string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// OK is final, as in OpenTelemetry
+	if s.ended || s.data.Status == StatusOK {
+		return
+	}
+
+	s.data.Status = code
+	if code == StatusError {
+		s.data.StatusDescription = description
+	}
+}
+
+func (s *span) End() {
+	s.mu.Lock()
+	if s.ended {
+		s.mu.Unlock()
+		return
+	}
+
+	s.ended = true
+	s.data.End = time.Now()
+	data := s.data
+	s.mu.Unlock()
+
+	if data.SpanContext.IsSampled() && s.tracer.exporter != nil {
+		s.tracer.exporter.Export(data)
+	}
+}
@@ -1,22 +1,66 @@
 package httpext
 
 import (
+	"bytes"
 	"context"
-	"encoding/json"
-	"errors"
+	"fmt"
 	"io"
 	"net/http"
+	"reflect"
+
+	"github.com/tanveerprottoy/stdlib-ext/httpext/codec"
+	"github.com/tanveerprottoy/stdlib-ext/httpext/roundtripper/logging"
 )
 
-// service implements the Requester interface
+// service implements the Requester and BodyRequester interfaces
 // it makes http requests using the client
 type service[R, E any] struct {
 	client Client
+	codecs *codec.Registry
+	accept string // the Accept header of requests without one
+}
+
+// serviceConfig holds the settings of ServiceOptions, it is not generic
+// so that options can be shared by services of different types
+type serviceConfig struct {
+	codecs     *codec.Registry
+	fullAccept bool
+}
+
+type ServiceOption func(*serviceConfig)
+
+// WithCodecs sets the codecs used to encode request bodies and decode responses by their Content-Type,
+// codec.DefaultRegistry is used by default
+func WithCodecs(r *codec.Registry) ServiceOption {
+	return func(c *serviceConfig) {
+		c.codecs = r
+	}
+}
+
+// WithFullAccept lists the media types of every codec in the Accept header of requests, preferring
+// the default codec. By default only the default codec's media type is accepted
+func WithFullAccept(enabled bool) ServiceOption {
+	return func(c *serviceConfig) {
+		c.fullAccept = enabled
+	}
 }
 
-func NewService[R, E any](client Client) *service[R, E] {
+func NewService[R, E any](client Client, opts ...ServiceOption) *service[R, E] {
+	cfg := serviceConfig{codecs: codec.DefaultRegistry()}
+
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+
+	accept := cfg.codecs.DefaultAccept()
+	if cfg.fullAccept {
+		accept = cfg.codecs.Accept()
+	}
+
 	return &service[R, E]{
 		client: client,
+		codecs: cfg.codecs,
+		accept: accept,
 	}
 }
 
@@ -32,7 +76,11 @@ func (s *service[R, E]) buildRequest(
 	}
 
 	if header != nil {
-		req.Header = header
+		req.Header = header.Clone()
+	}
+
+	if req.Header.Get("Accept") == "" {
+		req.Header.Set("Accept", s.accept)
 	}
 
 	return req, nil
@@ -42,7 +90,9 @@ func (s *service[R, E]) buildRequest(
 // generic paramters are provided by the struct itself
 // Generic parameters: R = response type, E = error type
 // use this function when you want to parse the response body to a specific type
-// and also parse the error response to a specific type
+// and also parse the error response to a specific type.
+// Non-2xx responses return an *HTTPError, E is nil if the error body was empty or couldn't be decoded.
+// Bodies are decoded with the codec of the response Content-Type, the default codec if it is unknown
 func (s *service[R, E]) Request(
 	ctx context.Context,
 	method string,
@@ -70,24 +120,100 @@ func (s *service[R, E]) Request(
 	defer resp.Body.Close()
 
 	if resp.StatusCode >= http.StatusOK && resp.StatusCode < http.StatusMultipleChoices {
-		// resp ok, parse response body to type
+		// resp ok, parse response body to type with the codec of its content type
+		data, err := io.ReadAll(resp.Body)
+		if err != nil {
+			return nil, nil, err
+		}
+
 		var r R
 
-		err := json.NewDecoder(resp.Body).Decode(&r)
-		if err != nil {
+		if err := s.codecs.For(resp.Header.Get("Content-Type")).Unmarshal(data, &r); err != nil {
 			return nil, nil, err
 		}
 
 		return &r, nil, nil
-	} else {
-		// resp not ok, parse error
-		var e E
+	}
 
-		err := json.NewDecoder(resp.Body).Decode(&e)
-		if err != nil {
-			return nil, nil, err
+	// resp not ok, keep the raw body and parse error
+	httpErr := &HTTPError{
+		Method:     req.Method,
+		URL:        logging.RedactURL(req.URL, logging.DefaultRedactedQueryParams),
+		StatusCode: resp.StatusCode,
+		Status:     resp.Status,
+		Header:     resp.Header,
+	}
+
+	httpErr.Body, err = io.ReadAll(io.LimitReader(resp.Body, maxErrorBodySize))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if len(httpErr.Body) == 0 {
+		return nil, nil, httpErr
+	}
+
+	var e E
+
+	if err := s.codecs.For(resp.Header.Get("Content-Type")).Unmarshal(httpErr.Body, &e); err != nil {
+		// the body may be an HTML page of a proxy or truncated
+		httpErr.DecodeErr = err
+		return nil, nil, httpErr
+	}
+
+	httpErr.Decoded = &e
+
+	return nil, &e, httpErr
+}
+
+// RequestBody encodes body and makes the request with Request. The encoded body is sent from
+// memory, which sets the Content-Length and lets retries replay it through GetBody.
+// A nil body, including a nil pointer, sends no body
+func (s *service[R, E]) RequestBody(
+	ctx context.Context,
+	method string,
+	url string,
+	header http.Header,
+	body any,
+	retry bool,
+) (*R, *E, error) {
+	if isNil(body) {
+		return s.Request(ctx, method, url, header, nil, retry)
+	}
+
+	header = header.Clone()
+	if header == nil {
+		header = make(http.Header)
+	}
+
+	c := s.codecs.Default()
+
+	if contentType := header.Get("Content-Type"); contentType != "" {
+		var ok bool
+
+		c, ok = s.codecs.Lookup(contentType)
+		if !ok {
+			return nil, nil, fmt.Errorf("httpext: no codec for Content-Type %q", contentType)
 		}
+	} else {
+		header.Set("Content-Type", c.ContentType())
+	}
 
-		return nil, &e, errors.New("error response was returned")
+	data, err := c.Marshal(body)
+	if err != nil {
+		return nil, nil, fmt.Errorf("httpext: encoding request body: %w", err)
 	}
+
+	return s.Request(ctx, method, url, header, bytes.NewReader(data), retry)
+}
+
+// isNil reports whether v is nil or a nil pointer, e.g. a nil *T passed as any
+func isNil(v any) bool {
+	if v == nil {
+		return true
+	}
+
+	rv := reflect.ValueOf(v)
+
+	return rv.Kind() == reflect.Pointer && rv.IsNil()
 }
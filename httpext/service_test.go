@@ -0,0 +1,178 @@
+package httpext_test
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/tanveerprottoy/stdlib-ext/httpext"
+	"github.com/tanveerprottoy/stdlib-ext/httpext/backoff"
+	"github.com/tanveerprottoy/stdlib-ext/httpext/codec"
+)
+
+type feed struct {
+	Title string `json:"title" xml:"title"`
+}
+
+func TestServiceCodecs(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Accept") == "" {
+			w.WriteHeader(http.StatusNotAcceptable)
+			return
+		}
+
+		if r.URL.Query().Get("format") == "xml" {
+			w.Header().Set("Content-Type", "application/atom+xml")
+			w.Write([]byte(`<feed><title>releases</title></feed>`))
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"title":"releases"}`))
+	}))
+	defer srv.Close()
+
+	s := httpext.NewService[feed, apiError](httpext.NewCustomClient(httpext.Config{}))
+
+	for _, format := range []string{"json", "xml"} {
+		// subtest per response format
+		t.Run(format, func(t *testing.T) {
+			f, _, err := s.Request(context.Background(), http.MethodGet, srv.URL+"?format="+format, nil, nil, false)
+			if err != nil {
+				t.Fatalf("Request error: %v", err)
+			}
+
+			if f.Title != "releases" {
+				t.Errorf("expected title releases, got %q", f.Title)
+			}
+		})
+	}
+}
+
+func TestServiceAccept(t *testing.T) {
+	var accept string
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		accept = r.Header.Get("Accept")
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"title":"releases"}`))
+	}))
+	defer srv.Close()
+
+	client := httpext.NewCustomClient(httpext.Config{})
+
+	tests := []struct {
+		name string
+		opts []httpext.ServiceOption
+		want string
+	}{
+		{name: "testDefaultCodecOnly", want: "application/json"},
+		{
+			name: "testFullAccept",
+			opts: []httpext.ServiceOption{httpext.WithCodecs(codec.NewRegistry(codec.JSON, codec.XML)), httpext.WithFullAccept(true)},
+			want: "application/json, application/xml;q=0.9",
+		},
+	}
+
+	for _, tt := range tests {
+		// subtest per Accept configuration
+		t.Run(tt.name, func(t *testing.T) {
+			s := httpext.NewService[feed, apiError](client, tt.opts...)
+
+			if _, _, err := s.Request(context.Background(), http.MethodGet, srv.URL, nil, nil, false); err != nil {
+				t.Fatalf("Request error: %v", err)
+			}
+
+			if accept != tt.want {
+				t.Errorf("expected Accept %q, got %q", tt.want, accept)
+			}
+		})
+	}
+}
+
+func TestRequestBody(t *testing.T) {
+	var attempts atomic.Int32
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+
+		// the first attempt fails so that the body has to be replayed
+		if r.URL.Path == "/retry" && attempts.Add(1) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+
+		if r.ContentLength != int64(len(body)) {
+			w.WriteHeader(http.StatusLengthRequired)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]string{
+			"content_type": r.Header.Get("Content-Type"),
+			"body":         string(body),
+		})
+	}))
+	defer srv.Close()
+
+	client := httpext.NewCustomClient(httpext.Config{MaxRetries: 2}, httpext.WithBackoff(backoff.NewConstant(time.Millisecond)))
+	s := httpext.NewService[map[string]string, apiError](client)
+
+	// subtest testDefaultCodecIsReplayed
+	t.Run("testDefaultCodecIsReplayed", func(t *testing.T) {
+		got, _, err := httpext.RequestWithBody(context.Background(), s, http.MethodPut, srv.URL+"/retry", nil, product{ID: "p1"}, true)
+		if err != nil {
+			t.Fatalf("RequestWithBody error: %v", err)
+		}
+
+		if (*got)["content_type"] != "application/json" || (*got)["body"] != `{"id":"p1"}` {
+			t.Errorf("unexpected request %v", *got)
+		}
+
+		if attempts.Load() != 2 {
+			t.Errorf("expected 2 attempts, got %d", attempts.Load())
+		}
+	})
+
+	// subtest testCodecOfContentType
+	t.Run("testCodecOfContentType", func(t *testing.T) {
+		header := http.Header{"Content-Type": {"application/x-www-form-urlencoded"}}
+
+		got, _, err := s.RequestBody(context.Background(), http.MethodPost, srv.URL, header, map[string]string{"q": "go"}, false)
+		if err != nil {
+			t.Fatalf("RequestBody error: %v", err)
+		}
+
+		if (*got)["body"] != "q=go" {
+			t.Errorf("expected a form body, got %q", (*got)["body"])
+		}
+	})
+
+	// subtest testNilPointerSendsNoBody
+	t.Run("testNilPointerSendsNoBody", func(t *testing.T) {
+		var body *product
+
+		got, _, err := httpext.RequestWithBody(context.Background(), s, http.MethodPost, srv.URL, nil, body, false)
+		if err != nil {
+			t.Fatalf("RequestWithBody error: %v", err)
+		}
+
+		if (*got)["content_type"] != "" || (*got)["body"] != "" {
+			t.Errorf("expected no body, got %v", *got)
+		}
+	})
+
+	// subtest testUnknownContentType
+	t.Run("testUnknownContentType", func(t *testing.T) {
+		header := http.Header{"Content-Type": {"application/x-protobuf"}}
+
+		if _, _, err := s.RequestBody(context.Background(), http.MethodPost, srv.URL, header, product{}, false); err == nil {
+			t.Errorf("expected an error for a Content-Type without codec")
+		}
+	})
+}
@@ -0,0 +1,144 @@
+package httpext
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/tanveerprottoy/stdlib-ext/tlsext"
+)
+
+// tlsConfig returns the TLS config of t, creating it if needed
+func tlsConfig(t *http.Transport) *tls.Config {
+	if t.TLSClientConfig == nil {
+		t.TLSClientConfig = &tls.Config{}
+	}
+
+	return t.TLSClientConfig
+}
+
+// withTLSError records a TLS configuration error, the client then fails every request with it
+// instead of connecting without the intended configuration
+func withTLSError(err error) Option {
+	return func(c *customClient) {
+		c.configErr = errors.Join(c.configErr, fmt.Errorf("httpext: TLS configuration: %w", err))
+	}
+}
+
+// WithTLSConfig sets the TLS config of the transport to a clone of cfg,
+// the other TLS options are applied on top of it wherever they come
+func WithTLSConfig(cfg *tls.Config) Option {
+	return func(c *customClient) {
+		c.tlsConfig = cfg
+	}
+}
+
+// WithRootCAs sets the certificate authorities used to verify servers, e.g. a private CA
+func WithRootCAs(pool *x509.CertPool) Option {
+	return withTransport(func(t *http.Transport) {
+		tlsConfig(t).RootCAs = pool
+	})
+}
+
+// WithCAFiles verifies servers with the certificates of the PEM encoded CA bundles,
+// in addition to the system roots when includeSystem is true
+func WithCAFiles(includeSystem bool, files ...string) Option {
+	pool, err := tlsext.LoadCertPool(includeSystem, files...)
+	if err != nil {
+		return withTLSError(err)
+	}
+
+	return WithRootCAs(pool)
+}
+
+// WithCAPEM verifies servers with the PEM encoded CA certificates,
+// in addition to the system roots when includeSystem is true
+func WithCAPEM(includeSystem bool, pems ...[]byte) Option {
+	pool, err := tlsext.CertPoolFromPEM(includeSystem, pems...)
+	if err != nil {
+		return withTLSError(err)
+	}
+
+	return WithRootCAs(pool)
+}
+
+// WithClientCertificate presents cert to servers requesting a client certificate (mTLS)
+func WithClientCertificate(cert tls.Certificate) Option {
+	return withTransport(func(t *http.Transport) {
+		cfg := tlsConfig(t)
+		cfg.Certificates = append(cfg.Certificates, cert)
+	})
+}
+
+// WithClientCertFiles presents the PEM encoded certificate and key as client certificate,
+// use WithClientCertReloading for certificates which are rotated
+func WithClientCertFiles(certFile, keyFile string) Option {
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return withTLSError(err)
+	}
+
+	return WithClientCertificate(cert)
+}
+
+// WithClientCertPEM presents the PEM encoded certificate and key as client certificate
+func WithClientCertPEM(certPEM, keyPEM []byte) Option {
+	cert, err := tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		return withTLSError(err)
+	}
+
+	return WithClientCertificate(cert)
+}
+
+// WithClientCertReloading presents the certificate and key files as client certificate and
+// reloads them at most every interval when they changed on disk, see tlsext.CertReloader
+func WithClientCertReloading(certFile, keyFile string, interval time.Duration) Option {
+	r, err := tlsext.NewCertReloader(certFile, keyFile, interval)
+	if err != nil {
+		return withTLSError(err)
+	}
+
+	return withTransport(func(t *http.Transport) {
+		tlsConfig(t).GetClientCertificate = r.GetClientCertificate
+	})
+}
+
+// WithMinTLSVersion sets the minimum TLS version, e.g. tls.VersionTLS13
+func WithMinTLSVersion(version uint16) Option {
+	return withTransport(func(t *http.Transport) {
+		tlsConfig(t).MinVersion = version
+	})
+}
+
+// WithCipherSuites restricts the TLS 1.0-1.2 cipher suites, TLS 1.3 suites are not configurable
+func WithCipherSuites(ids ...uint16) Option {
+	return withTransport(func(t *http.Transport) {
+		tlsConfig(t).CipherSuites = ids
+	})
+}
+
+// WithPinnedSPKI only accepts servers whose certificate chain contains a public key with one
+// of the base64 encoded SHA-256 SPKI hashes, see tlsext.SPKIHash. The chain is verified as usual first
+func WithPinnedSPKI(pins ...string) Option {
+	return withTransport(func(t *http.Transport) {
+		cfg := tlsConfig(t)
+		cfg.VerifyConnection = tlsext.ChainVerifyConnection(cfg.VerifyConnection, tlsext.PinnedSPKI(pins...))
+	})
+}
+
+// errRoundTripper fails every request, it replaces the transport of a misconfigured client
+type errRoundTripper struct {
+	err error
+}
+
+func (rt errRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Body != nil {
+		req.Body.Close()
+	}
+
+	return nil, rt.err
+}
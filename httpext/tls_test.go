@@ -0,0 +1,113 @@
+package httpext_test
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/tanveerprottoy/stdlib-ext/httpext"
+	"github.com/tanveerprottoy/stdlib-ext/internal/certtest"
+	"github.com/tanveerprottoy/stdlib-ext/tlsext"
+)
+
+func TestTLSOptions(t *testing.T) {
+	clientCert, clientCertPEM, clientKeyPEM := certtest.New(t, "client")
+
+	clientCAs := x509.NewCertPool()
+	clientCAs.AddCert(clientCert)
+
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if len(r.TLS.PeerCertificates) == 0 {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		w.Write([]byte(r.TLS.PeerCertificates[0].Subject.CommonName))
+	}))
+	srv.TLS = &tls.Config{ClientAuth: tls.RequireAndVerifyClientCert, ClientCAs: clientCAs}
+	srv.StartTLS()
+	defer srv.Close()
+
+	serverCAPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: srv.Certificate().Raw})
+
+	get := func(client httpext.Client) (*http.Response, error) {
+		req, _ := http.NewRequest(http.MethodGet, srv.URL, nil)
+		return client.Do(req, false)
+	}
+
+	// subtest testMutualTLS
+	t.Run("testMutualTLS", func(t *testing.T) {
+		client := httpext.NewCustomClient(
+			httpext.Config{},
+			httpext.WithCAPEM(false, serverCAPEM),
+			httpext.WithClientCertPEM(clientCertPEM, clientKeyPEM),
+			httpext.WithMinTLSVersion(tls.VersionTLS12),
+			httpext.WithPinnedSPKI("sha256/"+tlsext.SPKIHash(srv.Certificate())),
+		)
+
+		resp, err := get(client)
+		if err != nil {
+			t.Fatalf("client.Do error: %v", err)
+		}
+		defer resp.Body.Close()
+
+		if resp.StatusCode != http.StatusOK {
+			t.Errorf("expected status 200, got %d", resp.StatusCode)
+		}
+	})
+
+	// subtest testTLSConfigKeepsOtherOptions
+	t.Run("testTLSConfigKeepsOtherOptions", func(t *testing.T) {
+		client := httpext.NewCustomClient(
+			httpext.Config{},
+			httpext.WithCAPEM(false, serverCAPEM),
+			httpext.WithClientCertPEM(clientCertPEM, clientKeyPEM),
+			httpext.WithTLSConfig(&tls.Config{MinVersion: tls.VersionTLS12}),
+		)
+
+		resp, err := get(client)
+		if err != nil {
+			t.Fatalf("client.Do error: %v", err)
+		}
+		defer resp.Body.Close()
+
+		if resp.StatusCode != http.StatusOK {
+			t.Errorf("expected status 200, got %d", resp.StatusCode)
+		}
+	})
+
+	// subtest testPinMismatch
+	t.Run("testPinMismatch", func(t *testing.T) {
+		client := httpext.NewCustomClient(
+			httpext.Config{},
+			httpext.WithCAPEM(false, serverCAPEM),
+			httpext.WithClientCertPEM(clientCertPEM, clientKeyPEM),
+			httpext.WithPinnedSPKI(tlsext.SPKIHash(clientCert)),
+		)
+
+		if _, err := get(client); !errors.Is(err, tlsext.ErrPinMismatch) {
+			t.Errorf("expected ErrPinMismatch, got %v", err)
+		}
+	})
+
+	// subtest testConfigErrorFailsRequests
+	t.Run("testConfigErrorFailsRequests", func(t *testing.T) {
+		client := httpext.NewCustomClient(
+			httpext.Config{},
+			httpext.WithCAFiles(false, filepath.Join(t.TempDir(), "missing.pem")),
+		)
+
+		if client.Err() == nil {
+			t.Errorf("expected Err to report the missing CA file")
+		}
+
+		if _, err := get(client); err == nil {
+			t.Errorf("expected an error for the missing CA file")
+		}
+	})
+}
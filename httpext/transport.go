@@ -0,0 +1,132 @@
+package httpext
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// withTransport adds an option which configures the transport
+func withTransport(f func(t *http.Transport)) Option {
+	return func(c *customClient) {
+		c.transportOpts = append(c.transportOpts, f)
+	}
+}
+
+func WithMaxIdleConnsPerHost(maxIdleConnsPerHost int) Option {
+	return withTransport(func(t *http.Transport) {
+		t.MaxIdleConnsPerHost = maxIdleConnsPerHost
+	})
+}
+
+func WithIdleConnTimeout(idleConnTimeout time.Duration) Option {
+	return withTransport(func(t *http.Transport) {
+		t.IdleConnTimeout = idleConnTimeout
+	})
+}
+
+// WithDialer sets the timeout for establishing connections and the interval of TCP keep-alive probes,
+// a negative keepAlive disables them
+func WithDialer(timeout, keepAlive time.Duration) Option {
+	return withTransport(func(t *http.Transport) {
+		t.DialContext = (&net.Dialer{Timeout: timeout, KeepAlive: keepAlive}).DialContext
+	})
+}
+
+// WithTLSHandshakeTimeout sets the maximum time to wait for a TLS handshake
+func WithTLSHandshakeTimeout(d time.Duration) Option {
+	return withTransport(func(t *http.Transport) {
+		t.TLSHandshakeTimeout = d
+	})
+}
+
+// WithResponseHeaderTimeout sets the maximum time to wait for the response headers
+// after the request was written, it doesn't include reading the body
+func WithResponseHeaderTimeout(d time.Duration) Option {
+	return withTransport(func(t *http.Transport) {
+		t.ResponseHeaderTimeout = d
+	})
+}
+
+// WithExpectContinueTimeout sets the time to wait for the server's first response headers
+// after writing the headers of a request with "Expect: 100-continue", 0 sends the body immediately
+func WithExpectContinueTimeout(d time.Duration) Option {
+	return withTransport(func(t *http.Transport) {
+		t.ExpectContinueTimeout = d
+	})
+}
+
+// WithMaxConnsPerHost limits the connections per host in the dialing, active and idle states, 0 means no limit
+func WithMaxConnsPerHost(n int) Option {
+	return withTransport(func(t *http.Transport) {
+		t.MaxConnsPerHost = n
+	})
+}
+
+// WithProxy sets the function returning the proxy of a request, it replaces
+// http.ProxyFromEnvironment. A nil f disables proxies
+func WithProxy(f func(*http.Request) (*url.URL, error)) Option {
+	return withTransport(func(t *http.Transport) {
+		t.Proxy = f
+	})
+}
+
+// WithForceAttemptHTTP2 controls whether HTTP/2 is attempted when a custom dialer or TLS config is set,
+// enabled by default
+func WithForceAttemptHTTP2(enabled bool) Option {
+	return withTransport(func(t *http.Transport) {
+		t.ForceAttemptHTTP2 = enabled
+	})
+}
+
+// WithDisableCompression stops the transport from requesting gzip compressed responses and
+// transparently decompressing them
+func WithDisableCompression(disabled bool) Option {
+	return withTransport(func(t *http.Transport) {
+		t.DisableCompression = disabled
+	})
+}
+
+// WithBaseRoundTripper sets the RoundTripper which sends the requests in place of http.DefaultTransport.
+// The transport and TLS options are applied to a clone of rt, they require it to be an *http.Transport
+func WithBaseRoundTripper(rt http.RoundTripper) Option {
+	return func(c *customClient) {
+		c.baseTransport = rt
+	}
+}
+
+// errTransportOptions is returned when transport options are given for a base which isn't an *http.Transport
+var errTransportOptions = errors.New("httpext: transport and TLS options require the base RoundTripper to be an *http.Transport")
+
+// transport builds the RoundTripper at the bottom of the client, nil means http.DefaultTransport.
+// Options are applied to a clone so that proxies, dial and TLS handshake timeouts and HTTP/2
+// of the base are kept
+func (c *customClient) transport() (http.RoundTripper, error) {
+	if len(c.transportOpts) == 0 && c.tlsConfig == nil {
+		return c.baseTransport, nil
+	}
+
+	base := c.baseTransport
+	if base == nil {
+		base = http.DefaultTransport
+	}
+
+	t, ok := base.(*http.Transport)
+	if !ok {
+		return nil, errTransportOptions
+	}
+
+	t = t.Clone()
+
+	if c.tlsConfig != nil {
+		t.TLSClientConfig = c.tlsConfig.Clone()
+	}
+
+	for _, opt := range c.transportOpts {
+		opt(t)
+	}
+
+	return t, nil
+}
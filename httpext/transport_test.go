@@ -0,0 +1,120 @@
+package httpext_test
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/tanveerprottoy/stdlib-ext/httpext"
+	"github.com/tanveerprottoy/stdlib-ext/httpext/roundtripper"
+)
+
+func TestTransportOptions(t *testing.T) {
+	proxyURL, _ := url.Parse("http://proxy.internal:3128")
+
+	client := httpext.NewCustomClient(
+		httpext.Config{},
+		httpext.WithMaxIdleConnsPerHost(20),
+		httpext.WithDialer(time.Second, 15*time.Second),
+		httpext.WithTLSHandshakeTimeout(2*time.Second),
+		httpext.WithResponseHeaderTimeout(3*time.Second),
+		httpext.WithExpectContinueTimeout(0),
+		httpext.WithMaxConnsPerHost(50),
+		httpext.WithProxy(http.ProxyURL(proxyURL)),
+		httpext.WithDisableCompression(true),
+	)
+
+	tr, ok := client.HTTPClient().Transport.(*http.Transport)
+	if !ok {
+		t.Fatalf("expected *http.Transport, got %T", client.HTTPClient().Transport)
+	}
+
+	if tr == http.DefaultTransport {
+		t.Fatalf("expected a clone of http.DefaultTransport")
+	}
+
+	if tr.MaxIdleConnsPerHost != 20 || tr.MaxConnsPerHost != 50 {
+		t.Errorf("unexpected connection limits %d, %d", tr.MaxIdleConnsPerHost, tr.MaxConnsPerHost)
+	}
+
+	if tr.TLSHandshakeTimeout != 2*time.Second || tr.ResponseHeaderTimeout != 3*time.Second || tr.ExpectContinueTimeout != 0 {
+		t.Errorf("unexpected timeouts %v, %v, %v", tr.TLSHandshakeTimeout, tr.ResponseHeaderTimeout, tr.ExpectContinueTimeout)
+	}
+
+	if !tr.DisableCompression {
+		t.Errorf("expected compression to be disabled")
+	}
+
+	req, _ := http.NewRequest(http.MethodGet, "http://example.com", nil)
+	if u, _ := tr.Proxy(req); u == nil || u.Host != "proxy.internal:3128" {
+		t.Errorf("expected the proxy, got %v", u)
+	}
+
+	// kept from http.DefaultTransport
+	if !tr.ForceAttemptHTTP2 || tr.IdleConnTimeout != 90*time.Second || tr.MaxIdleConns != 100 {
+		t.Errorf("expected the defaults of http.DefaultTransport, got %v, %v, %d", tr.ForceAttemptHTTP2, tr.IdleConnTimeout, tr.MaxIdleConns)
+	}
+}
+
+func TestBaseRoundTripper(t *testing.T) {
+	// subtest testCustomRoundTripperIsUsedAsIs
+	t.Run("testCustomRoundTripperIsUsedAsIs", func(t *testing.T) {
+		var called bool
+
+		base := roundtripper.Func(func(req *http.Request) (*http.Response, error) {
+			called = true
+			return &http.Response{StatusCode: http.StatusOK, Body: http.NoBody, Request: req}, nil
+		})
+
+		client := httpext.NewCustomClient(httpext.Config{}, httpext.WithBaseRoundTripper(base))
+
+		req, _ := http.NewRequest(http.MethodGet, "http://example.com", nil)
+
+		resp, err := client.Do(req, false)
+		if err != nil {
+			t.Fatalf("client.Do error: %v", err)
+		}
+		resp.Body.Close()
+
+		if !called {
+			t.Errorf("expected the base RoundTripper to send the request")
+		}
+	})
+
+	// subtest testTransportOptionsRequireATransport
+	t.Run("testTransportOptionsRequireATransport", func(t *testing.T) {
+		base := roundtripper.Func(func(req *http.Request) (*http.Response, error) {
+			return &http.Response{StatusCode: http.StatusOK, Body: http.NoBody, Request: req}, nil
+		})
+
+		client := httpext.NewCustomClient(httpext.Config{}, httpext.WithBaseRoundTripper(base), httpext.WithMaxConnsPerHost(1))
+
+		if client.Err() == nil {
+			t.Fatalf("expected an error for transport options on a custom RoundTripper")
+		}
+
+		req, _ := http.NewRequest(http.MethodGet, "http://example.com", nil)
+
+		if _, err := client.Do(req, false); !errors.Is(err, client.Err()) {
+			t.Errorf("expected requests to fail with %v, got %v", client.Err(), err)
+		}
+	})
+
+	// subtest testTransportIsCloned
+	t.Run("testTransportIsCloned", func(t *testing.T) {
+		base := &http.Transport{MaxIdleConns: 7}
+
+		client := httpext.NewCustomClient(httpext.Config{}, httpext.WithBaseRoundTripper(base), httpext.WithMaxConnsPerHost(3))
+
+		tr := client.HTTPClient().Transport.(*http.Transport)
+		if tr == base || tr.MaxIdleConns != 7 || tr.MaxConnsPerHost != 3 {
+			t.Errorf("expected a configured clone of the base transport")
+		}
+
+		if base.MaxConnsPerHost != 0 {
+			t.Errorf("expected the base transport to be left alone")
+		}
+	})
+}
@@ -0,0 +1,231 @@
+package tlsext
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrPinMismatch is returned when no certificate of a connection matches a pinned public key
+var ErrPinMismatch = errors.New("tlsext: no certificate matches the pinned public keys")
+
+// CertPoolFromPEM returns a pool with the certificates of the PEM blocks, starting
+// from a copy of the system roots when includeSystem is true
+func CertPoolFromPEM(includeSystem bool, pems ...[]byte) (*x509.CertPool, error) {
+	pool := x509.NewCertPool()
+
+	if includeSystem {
+		system, err := x509.SystemCertPool()
+		if err != nil {
+			return nil, err
+		}
+
+		pool = system
+	}
+
+	for i, pem := range pems {
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("tlsext: no certificates found in PEM block %d", i)
+		}
+	}
+
+	return pool, nil
+}
+
+// LoadCertPool returns a pool with the certificates of the PEM encoded files, starting
+// from a copy of the system roots when includeSystem is true
+func LoadCertPool(includeSystem bool, files ...string) (*x509.CertPool, error) {
+	pems := make([][]byte, len(files))
+
+	for i, file := range files {
+		pem, err := os.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+
+		pems[i] = pem
+	}
+
+	pool, err := CertPoolFromPEM(includeSystem, pems...)
+	if err != nil {
+		return nil, fmt.Errorf("tlsext: loading %s: %w", strings.Join(files, ", "), err)
+	}
+
+	return pool, nil
+}
+
+// SPKIHash returns the base64 encoded SHA-256 hash of the certificate's SubjectPublicKeyInfo,
+// the format of HPKP pins and of
+//
+//	openssl x509 -pubkey -noout | openssl pkey -pubin -outform der | openssl dgst -sha256 -binary | base64
+func SPKIHash(cert *x509.Certificate) string {
+	sum := sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+	return base64.StdEncoding.EncodeToString(sum[:])
+}
+
+// PinnedSPKI returns a tls.Config.VerifyConnection function which accepts a connection only
+// if the leaf, an intermediate or the root certificate has one of the pinned SPKI hashes.
+// Pins may have the "sha256/" prefix. It runs after the regular chain verification,
+// without a verified chain only the leaf can match
+func PinnedSPKI(pins ...string) func(tls.ConnectionState) error {
+	pinned := make([]string, len(pins))
+	for i, pin := range pins {
+		pinned[i] = strings.TrimPrefix(pin, "sha256/")
+	}
+
+	return func(cs tls.ConnectionState) error {
+		// verified chains are empty with InsecureSkipVerify, then only the leaf is checked
+		// since a server can append any certificate to the ones it presents
+		chains := cs.VerifiedChains
+		if len(chains) == 0 {
+			if len(cs.PeerCertificates) == 0 {
+				return ErrPinMismatch
+			}
+
+			chains = [][]*x509.Certificate{cs.PeerCertificates[:1]}
+		}
+
+		for _, chain := range chains {
+			for _, cert := range chain {
+				if slices.Contains(pinned, SPKIHash(cert)) {
+					return nil
+				}
+			}
+		}
+
+		return ErrPinMismatch
+	}
+}
+
+// ChainVerifyConnection combines tls.Config.VerifyConnection functions, nil functions are skipped
+func ChainVerifyConnection(fs ...func(tls.ConnectionState) error) func(tls.ConnectionState) error {
+	return func(cs tls.ConnectionState) error {
+		for _, f := range fs {
+			if f == nil {
+				continue
+			}
+
+			if err := f(cs); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}
+}
+
+// CertReloader serves a client certificate from a cert/key file pair and reloads it when
+// the files change, so that rotated certificates are picked up without rebuilding clients.
+// The files are checked during handshakes at most once per interval. Use its
+// GetClientCertificate as tls.Config.GetClientCertificate
+type CertReloader struct {
+	certFile string
+	keyFile  string
+	interval time.Duration
+
+	mu          sync.Mutex
+	cert        *tls.Certificate
+	certModTime time.Time
+	keyModTime  time.Time
+	checked     time.Time
+	err         error
+}
+
+// NewCertReloader loads the key pair, interval <= 0 checks the files on every handshake
+func NewCertReloader(certFile, keyFile string, interval time.Duration) (*CertReloader, error) {
+	r := &CertReloader{certFile: certFile, keyFile: keyFile, interval: interval}
+
+	if err := r.Reload(); err != nil {
+		return nil, err
+	}
+
+	return r, nil
+}
+
+// Reload loads the key pair from the files, the current certificate is kept on failure
+func (r *CertReloader) Reload() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.reloadLocked()
+}
+
+func (r *CertReloader) reloadLocked() error {
+	certInfo, err := os.Stat(r.certFile)
+	if err != nil {
+		r.err = err
+		return err
+	}
+
+	keyInfo, err := os.Stat(r.keyFile)
+	if err != nil {
+		r.err = err
+		return err
+	}
+
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		// the pair may be half written during a rotation, the next check tries again
+		r.err = err
+		return err
+	}
+
+	r.cert = &cert
+	r.certModTime = certInfo.ModTime()
+	r.keyModTime = keyInfo.ModTime()
+	r.err = nil
+
+	return nil
+}
+
+// changedLocked reports whether either file has a different modification time
+func (r *CertReloader) changedLocked() bool {
+	certInfo, err := os.Stat(r.certFile)
+	if err != nil {
+		return false
+	}
+
+	keyInfo, err := os.Stat(r.keyFile)
+	if err != nil {
+		return false
+	}
+
+	return !certInfo.ModTime().Equal(r.certModTime) || !keyInfo.ModTime().Equal(r.keyModTime)
+}
+
+// Certificate returns the current certificate, reloading it first if the files changed
+func (r *CertReloader) Certificate() *tls.Certificate {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if now := time.Now(); now.Sub(r.checked) >= r.interval {
+		r.checked = now
+
+		if r.changedLocked() {
+			r.reloadLocked()
+		}
+	}
+
+	return r.cert
+}
+
+// Err returns the error of the last failed reload, nil once a reload succeeded
+func (r *CertReloader) Err() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.err
+}
+
+// GetClientCertificate implements tls.Config.GetClientCertificate
+func (r *CertReloader) GetClientCertificate(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+	return r.Certificate(), nil
+}
@@ -0,0 +1,108 @@
+package tlsext_test
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/tanveerprottoy/stdlib-ext/internal/certtest"
+	"github.com/tanveerprottoy/stdlib-ext/tlsext"
+)
+
+func TestCertPool(t *testing.T) {
+	cert, certPEM, _ := certtest.New(t, "ca")
+
+	dir := t.TempDir()
+	file := filepath.Join(dir, "ca.pem")
+	os.WriteFile(file, certPEM, 0o600)
+
+	pool, err := tlsext.LoadCertPool(false, file)
+	if err != nil {
+		t.Fatalf("LoadCertPool error: %v", err)
+	}
+
+	if _, err := cert.Verify(x509.VerifyOptions{Roots: pool}); err != nil {
+		t.Errorf("expected the certificate to verify against the pool: %v", err)
+	}
+
+	if _, err := tlsext.CertPoolFromPEM(false, []byte("not a certificate")); err == nil {
+		t.Errorf("expected an error for PEM without certificates")
+	}
+
+	if _, err := tlsext.LoadCertPool(false, filepath.Join(dir, "missing.pem")); err == nil {
+		t.Errorf("expected an error for a missing file")
+	}
+}
+
+func TestPinnedSPKI(t *testing.T) {
+	cert, _, _ := certtest.New(t, "server")
+	other, _, _ := certtest.New(t, "other")
+
+	state := tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{cert}}}
+
+	if err := tlsext.PinnedSPKI("sha256/" + tlsext.SPKIHash(cert))(state); err != nil {
+		t.Errorf("expected the pinned key to be accepted: %v", err)
+	}
+
+	if err := tlsext.PinnedSPKI(tlsext.SPKIHash(other))(state); !errors.Is(err, tlsext.ErrPinMismatch) {
+		t.Errorf("expected ErrPinMismatch, got %v", err)
+	}
+
+	// without verification a server could append the pinned certificate to an unpinned leaf
+	unverified := tls.ConnectionState{PeerCertificates: []*x509.Certificate{other, cert}}
+
+	if err := tlsext.PinnedSPKI(tlsext.SPKIHash(cert))(unverified); !errors.Is(err, tlsext.ErrPinMismatch) {
+		t.Errorf("expected ErrPinMismatch for an appended pinned certificate, got %v", err)
+	}
+}
+
+func TestCertReloader(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "client.pem"), filepath.Join(dir, "client-key.pem")
+
+	write := func(cn string, modTime time.Time) *x509.Certificate {
+		cert, certPEM, keyPEM := certtest.New(t, cn)
+		os.WriteFile(certFile, certPEM, 0o600)
+		os.WriteFile(keyFile, keyPEM, 0o600)
+
+		// file systems may have a coarse modification time resolution
+		os.Chtimes(certFile, modTime, modTime)
+		os.Chtimes(keyFile, modTime, modTime)
+
+		return cert
+	}
+
+	first := write("first", time.Now().Add(-time.Minute))
+
+	r, err := tlsext.NewCertReloader(certFile, keyFile, 0)
+	if err != nil {
+		t.Fatalf("NewCertReloader error: %v", err)
+	}
+
+	if got := r.Certificate().Leaf; !got.Equal(first) {
+		t.Errorf("expected the first certificate, got %s", got.Subject)
+	}
+
+	second := write("second", time.Now())
+
+	cert, _ := r.GetClientCertificate(nil)
+	if !cert.Leaf.Equal(second) {
+		t.Errorf("expected the rotated certificate, got %s", cert.Leaf.Subject)
+	}
+
+	// a broken rotation keeps the current certificate
+	os.WriteFile(keyFile, []byte("garbage"), 0o600)
+	os.Chtimes(keyFile, time.Now().Add(time.Minute), time.Now().Add(time.Minute))
+
+	if got := r.Certificate().Leaf; !got.Equal(second) {
+		t.Errorf("expected the second certificate to be kept, got %s", got.Subject)
+	}
+
+	if r.Err() == nil {
+		t.Errorf("expected the reload error")
+	}
+}